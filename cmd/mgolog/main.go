@@ -0,0 +1,295 @@
+// mgolog query log files written by mgo.Logger
+//
+// usage: mgolog [options] <pre|file>...
+//
+//	pre means all files <pre>-YYYYMMDDHH* including rotated and gzipped
+//	mgolog -level error -from "2026-10-17 08:00" /var/log/app
+//	mgolog -uuid 5f3c... -timeline /var/log/app
+//	mgolog -f -grep timeout /var/log/app
+//	mgolog -verify /var/log/audit
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mickyching/osmix/lib/mgo"
+)
+
+// record is a parsed line and its continuation lines, e.g. error stack
+type record struct {
+	e     *mgo.Entry
+	lines []string
+}
+
+type filter struct {
+	from  time.Time
+	to    time.Time
+	level mgo.Level
+	uuid  string
+	file  string
+	re    *regexp.Regexp
+}
+
+func (self *filter) match(r *record) bool {
+	e := r.e
+	if e.Level < self.level {
+		return false
+	}
+	if !self.from.IsZero() && e.Time.Before(self.from) {
+		return false
+	}
+	if !self.to.IsZero() && !e.Time.Before(self.to) {
+		return false
+	}
+	if self.uuid != "" && e.Uuid != self.uuid {
+		return false
+	}
+	if self.file != "" && !strings.Contains(e.File, self.file) {
+		return false
+	}
+	if self.re != nil && !self.re.MatchString(strings.Join(r.lines, "\n")) {
+		return false
+	}
+	return true
+}
+
+// scanner groups lines into records, unparsable lines belong to previous record
+type scanner struct {
+	cur  *record
+	emit func(r *record)
+}
+
+func (self *scanner) feed(line string) {
+	e, err := mgo.ParseLine(line)
+	if err != nil {
+		if self.cur != nil {
+			self.cur.lines = append(self.cur.lines, line)
+		}
+		return
+	}
+	self.flush()
+	self.cur = &record{e: e, lines: []string{line}}
+}
+
+func (self *scanner) flush() {
+	if self.cur != nil {
+		self.emit(self.cur)
+		self.cur = nil
+	}
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	layouts := []string{mgo.TIME_FORMAT, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02 15", "2006-01-02"}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// files returns arg itself if it is a file, else files of prefix arg
+func files(arg string) []string {
+	if fi, err := os.Stat(arg); err == nil && fi.Mode().IsRegular() {
+		return []string{arg}
+	}
+	return mgo.LogFiles(arg)
+}
+
+// scanFile feed lines of file to sc, error if file cannot be read to the end
+func scanFile(fname string, sc *scanner) error {
+	f, err := mgo.OpenLogFile(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	lio := mgo.NewLio(f)
+	for lio.Read() {
+		sc.feed(lio.Line())
+	}
+	if err := lio.Err(); err != nil {
+		return fmt.Errorf("read %s: %v", fname, err)
+	}
+	return nil
+}
+
+// follow print new lines of arg from its end, switch to new file when rotated
+func follow(arg string, sc *scanner) {
+	fname, offset := "", int64(0)
+	for {
+		if names := files(arg); len(names) > 0 {
+			last := names[len(names)-1]
+			if fname == "" {
+				fname, offset = last, mgo.FileSize(last)
+			} else if last != fname && !strings.HasSuffix(last, ".gz") {
+				readFrom(fname, offset, sc)
+				fname, offset = last, 0
+			}
+		}
+		if fname != "" {
+			offset = readFrom(fname, offset, sc)
+		}
+		sc.flush()
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// readFrom read whole lines from offset, returns offset after last whole line
+func readFrom(fname string, offset int64, sc *scanner) int64 {
+	f, err := os.Open(fname)
+	if err != nil {
+		return offset
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return offset
+		}
+		offset += int64(len(line))
+		sc.feed(strings.TrimRight(line, "\r\n"))
+	}
+}
+
+// timeline print records grouped by uuid, with offset to first record
+func timeline(groups map[string][]*record) {
+	uuids := []string{}
+	for uuid := range groups {
+		uuids = append(uuids, uuid)
+	}
+	sort.Slice(uuids, func(i, j int) bool {
+		return groups[uuids[i]][0].e.Time.Before(groups[uuids[j]][0].e.Time)
+	})
+
+	for _, uuid := range uuids {
+		rs := groups[uuid]
+		sort.SliceStable(rs, func(i, j int) bool { return rs[i].e.Time.Before(rs[j].e.Time) })
+		start := rs[0].e.Time
+		fmt.Printf("== %s %d lines %v [%s]\n", uuid, len(rs), rs[len(rs)-1].e.Time.Sub(start), mgo.TimeStr(start))
+		for _, r := range rs {
+			e := r.e
+			fmt.Printf("  +%-10v %s %s:%s():%d %s\n", e.Time.Sub(start), e.Level, e.File, e.Func, e.Line, e.Msg)
+			for _, line := range r.lines[1:] {
+				fmt.Printf("  %s\n", line)
+			}
+		}
+	}
+}
+
+// verifyAudit print broken points of audit chain, returns exit code
+func verifyAudit(args []string) int {
+	fnames := []string{}
+	for _, arg := range args {
+		fnames = append(fnames, files(arg)...)
+	}
+	problems, err := mgo.VerifyAudit(fnames...)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	fmt.Printf("%d files ok\n", len(fnames))
+	return 0
+}
+
+func main() {
+	from := flag.String("from", "", "start time, e.g. \"2026-10-17 08:00\"")
+	to := flag.String("to", "", "end time (exclusive)")
+	level := flag.String("level", "debug", "min level: debug/info/error/fatal")
+	uuid := flag.String("uuid", "", "only lines of uuid")
+	file := flag.String("file", "", "only lines from source file containing this")
+	grep := flag.String("grep", "", "only lines matching regex")
+	tail := flag.Bool("f", false, "follow new lines of the last file")
+	tl := flag.Bool("timeline", false, "group lines by uuid as request timeline")
+	verify := flag.Bool("verify", false, "verify audit chain of files, exit 1 if broken, 2 on read error")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [options] <pre|file>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var err error
+	ft := &filter{uuid: *uuid, file: *file}
+	if ft.from, err = parseTime(*from); err == nil {
+		ft.to, err = parseTime(*to)
+	}
+	if err == nil {
+		ft.level, err = mgo.ParseLevel(*level)
+	}
+	if err == nil && *grep != "" {
+		ft.re, err = regexp.Compile(*grep)
+	}
+	if err == nil && flag.NArg() == 0 {
+		err = fmt.Errorf("missing log file")
+	}
+	if err == nil && *tail && (*tl || flag.NArg() != 1) {
+		err = fmt.Errorf("-f requires one <pre|file> and no -timeline")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *verify {
+		os.Exit(verifyAudit(flag.Args()))
+	}
+
+	groups := map[string][]*record{}
+	sc := &scanner{emit: func(r *record) {
+		if !ft.match(r) {
+			return
+		}
+		if *tl {
+			if r.e.Uuid != "" {
+				groups[r.e.Uuid] = append(groups[r.e.Uuid], r)
+			}
+			return
+		}
+		fmt.Println(strings.Join(r.lines, "\n"))
+	}}
+
+	if *tail {
+		follow(flag.Arg(0), sc)
+		return
+	}
+
+	failed := false
+	for _, arg := range flag.Args() {
+		for _, fname := range files(arg) {
+			if err := scanFile(fname, sc); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed = true
+			}
+			sc.flush()
+		}
+	}
+	if *tl {
+		timeline(groups)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
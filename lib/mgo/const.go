@@ -1,17 +1,36 @@
 package mgo
 
-import "sync"
+import (
+	"sync"
+	"sync/atomic"
+)
 
 const (
 	TIME_FORMAT = "2006-01-02 15:04:05.000"
 	SIZE_1K     = 1024
 	SIZE_1M     = 1024 * 1024
+	REDACT_MASK = "***"
+
+	SPAN_RING_SIZE = 10000 // ended spans kept for WriteChromeTrace
+
+	SNOWFLAKE_BACKWARD_MS = 10 // clock regression waited by Snowflake.Next
+	BASE62_DIGITS         = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	LOG_LEVEL_ENV  = "MGO_LOG_LEVEL"
+	LOG_LEVELS_ENV = "MGO_LOG_LEVELS"
+
+	REQUEST_ID_HEADER = "X-Request-Id"
 )
 
 var (
 	once      = sync.Once{}
 	UuidCache = make(map[int64]string)
 	UuidMutex = sync.RWMutex{}
-	Glogger   = (*Logger)(nil)
+	uuidSize  = int32(0)       // atomic len(UuidCache), lock-free for log lines
+	glog      = atomic.Value{} // *Logger, global logger, see glogger
+	glogOnce  = sync.Once{}
+	glogMutex = sync.Mutex{}   // lock: glogDef, glogStd, glog update
+	glogDef   = (*Logger)(nil) // stdout logger used before InitGlogger
+	glogStd   = Sink(nil)      // stdout sink of glogDef, not kept by InitGlogger
 	Glimiter  = (*RateLimiter)(nil)
 )
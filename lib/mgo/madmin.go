@@ -0,0 +1,138 @@
+package mgo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminHandler returns handler for runtime log control and inspection
+// mount it at prefix, e.g. http.Handle("/debug/mgo/", AdminHandler("/debug/mgo"))
+//
+//	GET  /levels                           levels of global and named loggers
+//	POST /levels?name=http&level=debug     set level, or ?spec=http=debug,db=unset
+//	GET  /logs?n=100                       recent lines of global logger's RingSink
+//	GET  /uuids                            uuid-cache size and content
+//	GET  /profile/heap                     heap profile
+//	GET  /profile/cpu?seconds=30           cpu profile for seconds
+//	GET  /trace?seconds=60                 chrome trace of spans ended in last seconds
+func AdminHandler(prefix string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/levels", adminLevels)
+	mux.HandleFunc("/logs", adminLogs)
+	mux.HandleFunc("/uuids", adminUuids)
+	mux.HandleFunc("/profile/heap", adminHeap)
+	mux.HandleFunc("/profile/cpu", adminCpu)
+	mux.HandleFunc("/trace", adminTrace)
+	return http.StripPrefix(strings.TrimRight(prefix, "/"), mux)
+}
+
+func adminJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	e := json.NewEncoder(w)
+	e.SetIndent("", "    ")
+	e.Encode(v)
+}
+
+func adminLevels(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		spec := r.FormValue("spec")
+		if spec == "" {
+			spec = r.FormValue("name") + "=" + r.FormValue("level")
+		}
+		if err := SetLoggerLevels(spec); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		Infof("set logger levels %q from %s", spec, r.RemoteAddr)
+	}
+
+	type level struct {
+		Level     string `json:"level"`
+		Effective string `json:"effective"`
+	}
+	levels := map[string]level{}
+	for _, name := range append([]string{""}, LoggerNames()...) {
+		l := GetLogger(name)
+		levels[name] = level{l.OwnLevel().String(), l.GetLevel().String()}
+	}
+	adminJson(w, levels)
+}
+
+func adminLogs(w http.ResponseWriter, r *http.Request) {
+	var ring *RingSink
+	for _, s := range glogger().Sinks() {
+		if rs, ok := s.(*RingSink); ok {
+			ring = rs
+			break
+		}
+	}
+	if ring == nil {
+		http.Error(w, "no RingSink attached to global logger", http.StatusNotFound)
+		return
+	}
+
+	lines := ring.Lines()
+	if n, err := strconv.Atoi(r.FormValue("n")); err == nil && n >= 0 && n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+func adminUuids(w http.ResponseWriter, r *http.Request) {
+	UuidMutex.RLock()
+	uuids := make(map[string]string, len(UuidCache))
+	for gid, uuid := range UuidCache {
+		uuids[strconv.FormatInt(gid, 10)] = uuid
+	}
+	UuidMutex.RUnlock()
+
+	adminJson(w, map[string]interface{}{"size": len(uuids), "uuids": uuids})
+}
+
+func adminHeap(w http.ResponseWriter, r *http.Request) {
+	runtime.GC()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="heap.pprof"`)
+	pprof.WriteHeapProfile(w)
+}
+
+func adminCpu(w http.ResponseWriter, r *http.Request) {
+	secs, err := strconv.Atoi(r.FormValue("seconds"))
+	if err != nil || secs <= 0 {
+		secs = 30
+	}
+	dur := time.Duration(secs) * time.Second
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="cpu.pprof"`)
+	if err := pprof.StartCPUProfile(w); err != nil {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	select {
+	case <-time.After(dur):
+	case <-r.Context().Done():
+	}
+	pprof.StopCPUProfile()
+}
+
+func adminTrace(w http.ResponseWriter, r *http.Request) {
+	seconds, err := strconv.Atoi(r.FormValue("seconds"))
+	if err != nil || seconds <= 0 {
+		seconds = 60
+	}
+	to := time.Now()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", "attachment; filename=trace.json")
+	WriteChromeTrace(w, to.Add(-time.Duration(seconds)*time.Second), to)
+}
@@ -0,0 +1,212 @@
+package mgo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// suffix of audit line: "\t#seq=N sha256=HEX"
+const (
+	auditSeq  = "\t#seq="
+	auditHash = " sha256="
+)
+
+// AuditSink write tamper-evident lines to file <pre>-YYYYMMDDHH
+// each line carries sequence number and sha256 of previous hash and itself:
+//
+//	line\t#seq=N sha256=hex(sha256(prevHash + line + "\t#seq=N"))
+//
+// the chain goes across rotated files and is recovered from last file on start
+type AuditSink struct {
+	file  *FileSink
+	seq   int64  // seq of last line
+	hash  string // hash of last line, empty for first line
+	mutex sync.Mutex
+}
+
+// NewAuditSink create audit sink on sync file sink, chain is recovered from
+// last audit line of files <pre>-*, error if files cannot be read
+func NewAuditSink(pre string, size int64) (*AuditSink, error) {
+	s := &AuditSink{file: NewFileSink(true, pre, size)}
+	fnames := LogFiles(pre)
+	for i := len(fnames) - 1; i >= 0; i-- {
+		seq, hash, err := lastAudit(fnames[i])
+		if err != nil {
+			return nil, err
+		}
+		if seq > 0 {
+			s.seq, s.hash = seq, hash
+			break
+		}
+	}
+	return s, nil
+}
+
+// lastAudit returns seq and hash of last audit line in file, 0 if not found
+// error if file cannot be read to the end
+func lastAudit(fname string) (int64, string, error) {
+	f, err := OpenLogFile(fname)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	seq, hash := int64(0), ""
+	lio := NewLio(f)
+	for lio.Read() {
+		if _, n, h, ok := splitAudit(lio.Line()); ok {
+			seq, hash = n, h
+		}
+	}
+	if err := lio.Err(); err != nil {
+		return 0, "", fmt.Errorf("read audit %s: %v", fname, err)
+	}
+	return seq, hash, nil
+}
+
+// splitAudit split audit line into content with seq, seq and hash
+func splitAudit(line string) (string, int64, string, bool) {
+	i := strings.LastIndex(line, auditSeq)
+	if i < 0 {
+		return "", 0, "", false
+	}
+	j := strings.Index(line[i:], auditHash)
+	if j < 0 {
+		return "", 0, "", false
+	}
+	seq, err := strconv.ParseInt(line[i+len(auditSeq):i+j], 10, 64)
+	hash := line[i+j+len(auditHash):]
+	if err != nil || len(hash) != sha256.Size*2 {
+		return "", 0, "", false
+	}
+	return line[:i+j], seq, hash, true
+}
+
+// stripAudit returns line without audit suffix
+func stripAudit(line string) string {
+	if i := strings.LastIndex(line, auditSeq); i >= 0 && strings.Contains(line[i:], auditHash) {
+		return line[:i]
+	}
+	return line
+}
+
+func auditHashOf(prev, content string) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write([]byte(content))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// File returns file sink of audit sink, e.g. to set rotation policy
+func (self *AuditSink) File() *FileSink {
+	return self.file
+}
+
+// Write chain and write each line
+func (self *AuditSink) Write(b []byte) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	// chain moves on only after write, lines kept by file sink are dropped
+	// so a retry is chained again and no seq is written twice
+	seq, hash := self.seq, self.hash
+	buf := []byte{}
+	for _, line := range bytes.Split(bytes.TrimRight(b, "\n"), []byte("\n")) {
+		seq++
+		content := string(line) + auditSeq + strconv.FormatInt(seq, 10)
+		hash = auditHashOf(hash, content)
+		buf = append(buf, content...)
+		buf = append(buf, auditHash...)
+		buf = append(buf, hash...)
+		buf = append(buf, '\n')
+	}
+	if err := self.file.Write(buf); err != nil {
+		self.file.discard()
+		return err
+	}
+	self.seq, self.hash = seq, hash
+	return nil
+}
+
+// Flush flush file sink
+func (self *AuditSink) Flush() error {
+	return self.file.Flush()
+}
+
+// Close close file sink
+func (self *AuditSink) Close() error {
+	return self.file.Close()
+}
+
+// NewAuditLogger create logger of all levels writing to audit sink
+func NewAuditLogger(pre string, size int64) (*Logger, error) {
+	s, err := NewAuditSink(pre, size)
+	if err != nil {
+		return nil, err
+	}
+	l := &Logger{level: int32(LevelDebug)}
+	l.SetFormat(TextFormatter)
+	l.AddSink(s, LevelDebug, nil)
+	return l, nil
+}
+
+// AuditProblem is a broken point of audit chain
+type AuditProblem struct {
+	File   string
+	Line   int   // line number in file, from 1
+	Seq    int64 // seq of line, 0 if line has no audit suffix
+	Reason string
+}
+
+func (self AuditProblem) String() string {
+	return fmt.Sprintf("%s:%d seq=%d %s", self.File, self.Line, self.Seq, self.Reason)
+}
+
+// VerifyAudit check audit chain of files in order, returns broken points:
+// lines without suffix are inserted, seq gaps are deleted or reordered lines,
+// hash mismatches are edited lines, chain is resynced after each problem
+// first line with seq > 1 is trusted as start of pruned chain,
+// removed tail lines can not be detected
+// error if a file cannot be read to the end, problems found so far are returned
+func VerifyAudit(fnames ...string) ([]AuditProblem, error) {
+	problems := []AuditProblem{}
+	seq, hash := int64(0), ""
+	for _, fname := range fnames {
+		f, err := OpenLogFile(fname)
+		if err != nil {
+			return problems, err
+		}
+
+		lio := NewLio(f)
+		for num := 1; lio.Read(); num++ {
+			p := AuditProblem{File: fname, Line: num}
+			content, n, h, ok := splitAudit(lio.Line())
+			switch {
+			case !ok:
+				p.Reason = "missing audit suffix"
+				problems = append(problems, p)
+				continue
+			case seq == 0 && n > 1:
+			case n != seq+1:
+				p.Seq = n
+				p.Reason = fmt.Sprintf("seq %d after %d, lines deleted or reordered", n, seq)
+				problems = append(problems, p)
+			case auditHashOf(hash, content) != h:
+				p.Seq = n
+				p.Reason = "hash mismatch, line edited"
+				problems = append(problems, p)
+			}
+			seq, hash = n, h
+		}
+		f.Close()
+		if err := lio.Err(); err != nil {
+			return problems, fmt.Errorf("read audit %s: %v", fname, err)
+		}
+	}
+	return problems, nil
+}
@@ -0,0 +1,70 @@
+package mgo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuditLongLine(t *testing.T) {
+	pre := filepath.Join(t.TempDir(), "audit")
+	s, err := NewAuditSink(pre, 16*SIZE_1M)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("x", 200*SIZE_1K) // over old 128K line limit
+	for _, line := range []string{"l1", long, "l3", "l4"} {
+		s.Write([]byte(line + "\n"))
+	}
+	s.Close()
+
+	fnames := LogFiles(pre)
+	if len(fnames) != 1 {
+		t.Fatalf("files %v", fnames)
+	}
+	if problems, err := VerifyAudit(fnames...); err != nil || len(problems) != 0 {
+		t.Fatalf("clean chain: %v %v", problems, err)
+	}
+	s, err = NewAuditSink(pre, 16*SIZE_1M)
+	if err != nil || s.seq != 4 {
+		t.Fatalf("recovered seq %d: %v", s.seq, err)
+	}
+	s.Close()
+
+	b, _ := os.ReadFile(fnames[0])
+	os.WriteFile(fnames[0], []byte(strings.Replace(string(b), "l3\t", "L3\t", 1)), 0644)
+	problems, err := VerifyAudit(fnames...)
+	if err != nil || len(problems) != 1 || problems[0].Seq != 3 {
+		t.Errorf("edited line after long line: %v %v", problems, err)
+	}
+}
+
+func TestAuditWriteFailed(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "d")
+	os.WriteFile(dir, nil, 0644) // file in place of dir, open fails
+	pre := filepath.Join(dir, "audit")
+	s, err := NewAuditSink(pre, 16*SIZE_1M)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write([]byte("l1\n")); err == nil || s.seq != 0 {
+		t.Fatalf("failed write seq %d: %v", s.seq, err)
+	}
+	os.Remove(dir)
+	for _, line := range []string{"l1", "l2"} {
+		if err := s.Write([]byte(line + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+
+	fnames := LogFiles(pre)
+	if problems, err := VerifyAudit(fnames...); err != nil || len(problems) != 0 || s.seq != 2 {
+		t.Fatalf("chain after failed write seq %d: %v %v", s.seq, problems, err)
+	}
+	b, _ := os.ReadFile(fnames[0])
+	if n := strings.Count(string(b), "l1"); n != 1 {
+		t.Errorf("l1 written %d times", n)
+	}
+}
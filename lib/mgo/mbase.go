@@ -2,18 +2,18 @@ package mgo
 
 import (
 	"bufio"
-	"bytes"
-	"crypto/rand"
+	"context"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/exec"
 	"path"
 	"runtime"
 	"runtime/pprof"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,8 +23,10 @@ func StartProfile(fcpu string) {
 	f, err := os.Create(fcpu)
 	if err != nil {
 		Fatalf(err)
+		return
 	}
 	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
 		Fatalf(err)
 	}
 }
@@ -39,12 +41,13 @@ func MemProfile(fmem string) {
 	f, err := os.Create(fmem)
 	if err != nil {
 		Fatalf(err)
+		return
 	}
+	defer f.Close()
 	runtime.GC()
 	if err := pprof.WriteHeapProfile(f); err != nil {
 		Fatalf(err)
 	}
-	f.Close()
 }
 
 // RunCmd exec cmd with args
@@ -118,63 +121,74 @@ func WriteFile(fname, info string) error {
 }
 
 // GoFunc run func with num concurrency routines
+// routines get copy of caller's uuid and Gls values, removed when f returns
 func GoFunc(num int, f func()) *sync.WaitGroup {
 	wg := sync.WaitGroup{}
 	if num < 1 {
 		return &wg
 	}
 
+	run := glsWrap(f)
 	wg.Add(num)
 	for i := 0; i < num; i++ {
 		go func() {
 			defer wg.Done()
-			f()
+			run()
 		}()
 	}
 	return &wg
 }
 
 // GoId returns current Goroutine ID
+// it formats current stack by runtime.Stack, costs microseconds growing with stack depth
 func GoId() int64 {
-	gid := func(s []byte) int64 {
-		s = s[len("goroutine "):]
-		s = s[:bytes.IndexByte(s, ' ')]
-		gid, _ := strconv.ParseInt(string(s), 10, 64)
-		return gid
-	}
 	var buf [64]byte
-	return gid(buf[:runtime.Stack(buf[:], false)])
+	s := buf[len("goroutine "):runtime.Stack(buf[:], false)]
+	gid := int64(0)
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			break
+		}
+		gid = gid*10 + int64(c-'0')
+	}
+	return gid
 }
 
-// Uuid returns uuid base on current time
+// Uuid returns time-ordered RFC 9562 uuid v7, see UuidV7
 func Uuid() string {
+	return UuidV7().String()
+}
+
+// UuidLegacy returns uuid "unix32-xx-xx-xx-xx-xxxxxxxx" base on current time
+// it is the old format of Uuid, not a valid RFC 9562 uuid
+func UuidLegacy() string {
 	unix32bits := uint32(time.Now().UTC().Unix())
 	buff := make([]byte, 12)
-	numRead, err := rand.Read(buff)
-	if numRead != len(buff) || err != nil {
-		Fatalf(err)
-	}
+	randRead(buff)
 
 	return fmt.Sprintf("%x-%x-%x-%x-%x-%x", unix32bits, buff[0:2], buff[2:4], buff[4:6], buff[6:8], buff[8:])
 }
 
 // UuidCacheSize returns uuid-cache size
 func UuidCacheSize() int {
-	UuidMutex.RLock()
-	num := len(UuidCache)
-	UuidMutex.RUnlock()
-	return num
+	return int(atomic.LoadInt32(&uuidSize))
 }
 
 // SetUuid set uuid
 func SetUuid(uuid string) {
 	UuidMutex.Lock()
 	UuidCache[GoId()] = uuid
+	atomic.StoreInt32(&uuidSize, int32(len(UuidCache)))
 	UuidMutex.Unlock()
 }
 
 // GetUuid returns current goroutine's uuid
+// empty cache returns without GoId lookup, otherwise each call costs a GoId
+// hot paths should carry uuid by ctx, see WithRequestID and InfofCtx
 func GetUuid() string {
+	if atomic.LoadInt32(&uuidSize) == 0 {
+		return ""
+	}
 	UuidMutex.RLock()
 	uuid := UuidCache[GoId()]
 	UuidMutex.RUnlock()
@@ -186,9 +200,144 @@ func DelUuid() {
 	UuidMutex.Lock()
 	defer UuidMutex.Unlock()
 	delete(UuidCache, GoId())
+	atomic.StoreInt32(&uuidSize, int32(len(UuidCache)))
+}
+
+type requestIdKey struct{}
+
+// WithRequestID returns ctx carrying request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, id)
+}
+
+// RequestIDFrom returns request id carried by ctx, empty if not set
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// ctxUuid returns ctx's request id, fallback to current goroutine's uuid
+func ctxUuid(ctx context.Context) string {
+	if ctx != nil {
+		if id := RequestIDFrom(ctx); id != "" {
+			return id
+		}
+	}
+	return GetUuid()
+}
+
+// Snowflake generate int64 ids sorted by time, layout from high bits:
+// 1 zero sign bit, ms since epoch, node bits, sequence bits
+type Snowflake struct {
+	epoch    int64 // unix ms
+	node     int64
+	nodeBits uint
+	seqBits  uint
+	last     int64 // ms since epoch of last id
+	seq      int64
+	mutex    sync.Mutex
+}
+
+// NewSnowflake create id generator, e.g. twitter layout is nodeBits 10 and
+// seqBits 12, nodeBits+seqBits <= 22 keeps at least 41 bits (69 years) of ms
+func NewSnowflake(epoch time.Time, node int64, nodeBits, seqBits uint) (*Snowflake, error) {
+	if seqBits < 1 || nodeBits+seqBits > 22 {
+		return nil, fmt.Errorf("invalid snowflake bits node=%d seq=%d", nodeBits, seqBits)
+	}
+	if node < 0 || node >= 1<<nodeBits {
+		return nil, fmt.Errorf("snowflake node %d out of %d bits", node, nodeBits)
+	}
+	if epoch.After(time.Now()) {
+		return nil, fmt.Errorf("snowflake epoch %v is in future", epoch)
+	}
+	return &Snowflake{epoch: epoch.UnixMilli(), node: node, nodeBits: nodeBits, seqBits: seqBits}, nil
+}
+
+// Next returns next id, waits next ms if sequence is used up
+// clock going back up to SNOWFLAKE_BACKWARD_MS is waited, more is error
+func (self *Snowflake) Next() (int64, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	now := time.Now().UnixMilli() - self.epoch
+	if now < self.last {
+		if self.last-now > SNOWFLAKE_BACKWARD_MS {
+			return 0, fmt.Errorf("snowflake clock moved back %dms", self.last-now)
+		}
+		time.Sleep(time.Duration(self.last-now) * time.Millisecond)
+		now = self.waitAfter(self.last - 1)
+	}
+	if now == self.last {
+		self.seq = (self.seq + 1) & (1<<self.seqBits - 1)
+		if self.seq == 0 {
+			now = self.waitAfter(self.last)
+		}
+	} else {
+		self.seq = 0
+	}
+	if now >= 1<<(63-self.nodeBits-self.seqBits) {
+		return 0, fmt.Errorf("snowflake time overflow, epoch too old")
+	}
+	self.last = now
+	return now<<(self.nodeBits+self.seqBits) | self.node<<self.seqBits | self.seq, nil
 }
 
-// Lio is line-based bufio
+// waitAfter wait until ms since epoch is after ms, returns it
+func (self *Snowflake) waitAfter(ms int64) int64 {
+	now := time.Now().UnixMilli() - self.epoch
+	for now <= ms {
+		time.Sleep(100 * time.Microsecond)
+		now = time.Now().UnixMilli() - self.epoch
+	}
+	return now
+}
+
+// NextBase62 returns next id formatted by Base62
+func (self *Snowflake) NextBase62() (string, error) {
+	id, err := self.Next()
+	if err != nil {
+		return "", err
+	}
+	return Base62(id), nil
+}
+
+// Decode returns time, node and sequence of id
+func (self *Snowflake) Decode(id int64) (time.Time, int64, int64) {
+	seq := id & (1<<self.seqBits - 1)
+	node := id >> self.seqBits & (1<<self.nodeBits - 1)
+	ms := id>>(self.nodeBits+self.seqBits) + self.epoch
+	return time.UnixMilli(ms), node, seq
+}
+
+// Base62 format id as 11 chars of BASE62_DIGITS, strings sort as ids
+// negative id is formatted as uint64 and sorts after positive ids
+func Base62(id int64) string {
+	buf := [11]byte{}
+	n := uint64(id)
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i] = BASE62_DIGITS[n%62]
+		n /= 62
+	}
+	return string(buf[:])
+}
+
+// ParseBase62 parse id formatted by Base62
+func ParseBase62(s string) (int64, error) {
+	if len(s) != 11 {
+		return 0, fmt.Errorf("invalid base62 id %q", s)
+	}
+	n := uint64(0)
+	for i := 0; i < len(s); i++ {
+		d := strings.IndexByte(BASE62_DIGITS, s[i])
+		if d < 0 || n > (1<<64-1-uint64(d))/62 {
+			return 0, fmt.Errorf("invalid base62 id %q", s)
+		}
+		n = n*62 + uint64(d)
+	}
+	return int64(n), nil
+}
+
+// Lio is line-based bufio, read lines have no length limit
 type Lio struct {
 	r *bufio.Scanner
 	w *bufio.Writer
@@ -201,7 +350,7 @@ func NewLio(f interface{}) *Lio {
 	if r, ok := f.(io.Reader); ok {
 		buf := make([]byte, bufsize)
 		l.r = bufio.NewScanner(r)
-		l.r.Buffer(buf, bufsize)
+		l.r.Buffer(buf, math.MaxInt)
 		l.r.Split(bufio.ScanLines)
 	}
 	if w, ok := f.(io.Writer); ok {
@@ -210,11 +359,16 @@ func NewLio(f interface{}) *Lio {
 	return l
 }
 
-// Read read line to lio
+// Read read line to lio, false at EOF or error, see Err
 func (self *Lio) Read() bool {
 	return self.r.Scan()
 }
 
+// Err returns first non-EOF read error
+func (self *Lio) Err() error {
+	return self.r.Err()
+}
+
 // Line get line from lio
 func (self *Lio) Line() string {
 	return self.r.Text()
@@ -0,0 +1,188 @@
+package mgo
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Field returns value of field key in entry
+func (self *Entry) Field(key string) (interface{}, bool) {
+	for i := len(self.Fields) - 1; i >= 0; i-- {
+		if self.Fields[i].Key == key {
+			return self.Fields[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// CaptureSink keeps entries in memory, for asserting logs in tests
+// entries written by Logger.Write are parsed by ParseLine
+type CaptureSink struct {
+	entries []Entry
+	mutex   sync.Mutex
+}
+
+// NewCaptureSink create empty capture sink
+func NewCaptureSink() *CaptureSink {
+	return &CaptureSink{}
+}
+
+// WriteEntry save a copy of e
+func (self *CaptureSink) WriteEntry(e *Entry) error {
+	c := *e
+	c.Fields = append([]Field{}, e.Fields...)
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.entries = append(self.entries, c)
+	return nil
+}
+
+// Write parse and save raw lines, unparsable lines are saved as info msg
+func (self *CaptureSink) Write(b []byte) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, line := range bytes.Split(bytes.TrimRight(b, "\n"), []byte("\n")) {
+		e, err := ParseLine(string(line))
+		if err != nil {
+			e = &Entry{Level: LevelInfo, Msg: string(line)}
+		}
+		self.entries = append(self.entries, *e)
+	}
+	return nil
+}
+
+// Flush do nothing
+func (self *CaptureSink) Flush() error {
+	return nil
+}
+
+// Close do nothing
+func (self *CaptureSink) Close() error {
+	return nil
+}
+
+// Entries returns captured entries, oldest first
+func (self *CaptureSink) Entries() []Entry {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return append([]Entry{}, self.entries...)
+}
+
+// Reset drop captured entries
+func (self *CaptureSink) Reset() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.entries = nil
+}
+
+// Find returns entries of level whose msg contains substr and fields match kv
+// LevelUnset matches any level, kv values are compared by %v
+func (self *CaptureSink) Find(level Level, substr string, kv ...interface{}) []Entry {
+	want := fieldsOf(kv)
+	es := []Entry{}
+	for _, e := range self.Entries() {
+		if level != LevelUnset && e.Level != level {
+			continue
+		}
+		if !strings.Contains(e.Msg, substr) || !hasFields(&e, want) {
+			continue
+		}
+		es = append(es, e)
+	}
+	return es
+}
+
+// Contains check any entry matches, see Find
+func (self *CaptureSink) Contains(level Level, substr string, kv ...interface{}) bool {
+	return len(self.Find(level, substr, kv...)) > 0
+}
+
+func hasFields(e *Entry, want []Field) bool {
+	for _, f := range want {
+		v, ok := e.Field(f.Key)
+		if !ok || fmt.Sprint(v) != fmt.Sprint(f.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// TB is the part of testing.TB used by assert helpers
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertLogged report error to t if no entry matches, see Find
+func (self *CaptureSink) AssertLogged(t TB, level Level, substr string, kv ...interface{}) bool {
+	t.Helper()
+	if self.Contains(level, substr, kv...) {
+		return true
+	}
+	t.Errorf("no %v log contains %q with %v, captured:\n%s", level, substr, kv, self.dump())
+	return false
+}
+
+// AssertNotLogged report error to t if any entry matches, see Find
+func (self *CaptureSink) AssertNotLogged(t TB, level Level, substr string, kv ...interface{}) bool {
+	t.Helper()
+	es := self.Find(level, substr, kv...)
+	if len(es) == 0 {
+		return true
+	}
+	t.Errorf("unexpected %v log contains %q with %v: %s", level, substr, kv, TextFormatter(nil, &es[0]))
+	return false
+}
+
+// AssertCount report error to t if number of matched entries is not n, see Find
+func (self *CaptureSink) AssertCount(t TB, n int, level Level, substr string, kv ...interface{}) bool {
+	t.Helper()
+	if num := len(self.Find(level, substr, kv...)); num != n {
+		t.Errorf("%d %v logs contain %q with %v, want %d, captured:\n%s", num, level, substr, kv, n, self.dump())
+		return false
+	}
+	return true
+}
+
+// dump returns captured entries in text format
+func (self *CaptureSink) dump() string {
+	b := []byte{}
+	for _, e := range self.Entries() {
+		b = append(TextFormatter(b, &e), '\n')
+	}
+	return string(b)
+}
+
+// SwapGlogger replace global logger with l, returns func to restore it
+// named loggers follow global logger, e.g. in tests:
+//
+//	restore := mgo.SwapGlogger(l)
+//	defer restore()
+//
+// global logger is not initialized by swap, so InitGlogger still works after restore
+// read current global logger with Glog, the Glogger variable is removed
+func SwapGlogger(l *Logger) func() {
+	old, _ := glog.Swap(l).(*Logger)
+	return func() {
+		glog.Store(old)
+	}
+}
+
+// CaptureGlogger replace global logger with one capturing all levels
+// returns capture sink and func to restore global logger, e.g. in tests:
+//
+//	logs, restore := mgo.CaptureGlogger()
+//	defer restore()
+//	...
+//	logs.AssertLogged(t, mgo.LevelError, "timeout", "host", "a")
+func CaptureGlogger() (*CaptureSink, func()) {
+	c := NewCaptureSink()
+	l := &Logger{level: int32(LevelDebug)}
+	l.SetFormat(TextFormatter)
+	l.AddSink(c, LevelDebug, nil)
+	return c, SwapGlogger(l)
+}
@@ -0,0 +1,88 @@
+package mgo
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// fakeTB records errors of assert helpers
+type fakeTB struct {
+	errs []string
+}
+
+func (self *fakeTB) Helper() {}
+
+func (self *fakeTB) Errorf(format string, args ...interface{}) {
+	self.errs = append(self.errs, fmt.Sprintf(format, args...))
+}
+
+func TestCaptureGlogger(t *testing.T) {
+	logs, restore := CaptureGlogger()
+	defer restore()
+
+	SetUuid("u-1")
+	Infow("connect", "host", "a", "port", 80)
+	DelUuid()
+	GetLogger("capture.db").Errorw("query failed", "table", "t1")
+	glogger().Write("raw line\n")
+
+	es := logs.Find(LevelInfo, "connect", "port", 80)
+	if len(es) != 1 || es[0].Uuid != "u-1" || es[0].File != "mcapture_test.go" || es[0].Line == 0 {
+		t.Fatalf("entries %+v", es)
+	}
+	logs.AssertLogged(t, LevelError, "query", "table", "t1", "logger", "capture.db")
+	logs.AssertLogged(t, LevelInfo, "raw line")
+	logs.AssertNotLogged(t, LevelDebug, "")
+	logs.AssertCount(t, 3, LevelUnset, "")
+
+	ft := &fakeTB{}
+	if logs.AssertLogged(ft, LevelInfo, "connect", "host", "b") ||
+		logs.AssertNotLogged(ft, LevelInfo, "connect") ||
+		logs.AssertCount(ft, 2, LevelError, "") {
+		t.Errorf("failed asserts returned true")
+	}
+	if len(ft.errs) != 3 {
+		t.Errorf("errors %q", ft.errs)
+	}
+
+	logs.Reset()
+	logs.AssertCount(t, 0, LevelUnset, "")
+}
+
+func TestSwapGlogger(t *testing.T) {
+	before := loadGlogger()
+	outer, restoreOuter := CaptureGlogger()
+
+	stop, ready := make(chan struct{}), make(chan struct{})
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() { // logs during swaps, checked by go test -race
+		defer wg.Done()
+		GetLogger("capture.bg").Debugf("background")
+		close(ready)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				GetLogger("capture.bg").Debugf("background")
+			}
+		}
+	}()
+	<-ready
+	for i := 0; i < 10; i++ {
+		logs, restore := CaptureGlogger()
+		Glog().Infof("swap %d", i)
+		logs.AssertLogged(t, LevelInfo, fmt.Sprintf("swap %d", i))
+		restore()
+	}
+	close(stop)
+	wg.Wait()
+	outer.AssertLogged(t, LevelDebug, "background")
+
+	restoreOuter()
+	if loadGlogger() != before {
+		t.Errorf("global logger not restored")
+	}
+}
@@ -309,6 +309,7 @@ func JsonSave(fname string, v interface{}) {
 	f, err := os.Create(fname)
 	if err != nil {
 		Fatalf(err)
+		return
 	}
 	defer f.Close()
 
@@ -324,6 +325,7 @@ func JsonLoad(fname string, v interface{}) {
 	f, err := os.Open(fname)
 	if err != nil {
 		Fatalf(err)
+		return
 	}
 	defer f.Close()
 
@@ -0,0 +1,203 @@
+package mgo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	errorStack  int32        // atomic, record stack in Error if not 0
+	fatalPolicy int32        // atomic FatalPolicy
+	fatalHook   atomic.Value // func(*Error)
+)
+
+// SetErrorStack enable or disable recording stack in Error
+func SetErrorStack(on bool) {
+	if on {
+		atomic.StoreInt32(&errorStack, 1)
+	} else {
+		atomic.StoreInt32(&errorStack, 0)
+	}
+}
+
+func errorStackOn() bool {
+	return atomic.LoadInt32(&errorStack) != 0
+}
+
+// FatalPolicy decides what Fatalf does after logging and flushing
+type FatalPolicy int32
+
+const (
+	FatalPanic FatalPolicy = iota // panic with *Error, can be caught by Recover
+	FatalExit                     // os.Exit(1)
+	FatalHook                     // call hook set by SetFatalHook and return
+)
+
+// SetFatalPolicy set fatal policy, default FatalPanic
+func SetFatalPolicy(p FatalPolicy) {
+	atomic.StoreInt32(&fatalPolicy, int32(p))
+}
+
+// SetFatalHook set hook and policy to FatalHook
+// Fatalf returns after hook, so callers continue with zero values
+func SetFatalHook(hook func(err *Error)) {
+	fatalHook.Store(hook)
+	SetFatalPolicy(FatalHook)
+}
+
+func handleFatal(e *Error) {
+	switch FatalPolicy(atomic.LoadInt32(&fatalPolicy)) {
+	case FatalExit:
+		os.Exit(1)
+	case FatalHook:
+		if hook, _ := fatalHook.Load().(func(*Error)); hook != nil {
+			hook(e)
+			return
+		}
+	}
+	panic(e)
+}
+
+// Recover convert fatal panic into error, other panics are re-panicked
+// usage: defer Recover(&err)
+func Recover(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	e, ok := r.(*Error)
+	if !ok {
+		panic(r)
+	}
+	*err = e
+}
+
+// Error is error with caller, optional stack and wrapped cause
+// %v prints message, %+v also prints caller and stack
+type Error struct {
+	msg   string
+	cause error     // error wrapped by %w or Errorf(err), nil if none
+	File  string    // caller file base name
+	Func  string    // caller function name
+	Line  int       // caller line number
+	stack []uintptr // nil if stack is disabled
+}
+
+// errorOf returns message formatted as sprintf and cause wrapped by %w
+// errorOf(err) returns err as cause
+func errorOf(f interface{}, args ...interface{}) (string, error) {
+	if err, ok := f.(error); ok && len(args) == 0 {
+		return strings.TrimSpace(err.Error()), err
+	}
+	fs, ok := f.(string)
+	if !ok {
+		fs = fmt.Sprintf("%v", f) + strings.Repeat(" [%v]", len(args))
+	}
+
+	err := fmt.Errorf(fs, args...)
+	msg := strings.TrimSpace(err.Error())
+	switch x := err.(type) {
+	case interface{ Unwrap() error }:
+		return msg, x.Unwrap()
+	case interface{ Unwrap() []error }:
+		return msg, err
+	}
+	return msg, nil
+}
+
+// newError returns error with caller, depth is caller depth of newError
+func newError(depth int, msg string, cause error, stack bool) *Error {
+	_, c := callerFrame(depth + 1)
+
+	e := &Error{
+		msg:   msg,
+		cause: cause,
+		File:  c.file,
+		Func:  c.fn,
+		Line:  c.line,
+	}
+	if stack {
+		e.stack = stackOf(depth + 1)
+	}
+	return e
+}
+
+// stackOf returns pcs of whole stack from caller of skip frames
+func stackOf(skip int) []uintptr {
+	pcs := make([]uintptr, 32)
+	for {
+		n := runtime.Callers(skip+1, pcs)
+		if n < len(pcs) {
+			return pcs[:n]
+		}
+		pcs = make([]uintptr, 2*len(pcs))
+	}
+}
+
+// NewError returns *Error without logging, log it once at top with %+v
+func NewError(f interface{}, args ...interface{}) error {
+	msg, cause := errorOf(f, args...)
+	return newError(2, msg, cause, errorStackOn())
+}
+
+func (self *Error) Error() string {
+	return self.msg
+}
+
+// Unwrap returns wrapped cause for errors.Is/As
+func (self *Error) Unwrap() error {
+	return self.cause
+}
+
+// Caller returns file:func():line where error created
+func (self *Error) Caller() string {
+	return fmt.Sprintf("%s:%s():%d", self.File, self.Func, self.Line)
+}
+
+// Stack returns stack where error created, empty if stack is disabled
+func (self *Error) Stack() string {
+	if len(self.stack) == 0 {
+		return ""
+	}
+
+	sb := strings.Builder{}
+	frames := runtime.CallersFrames(self.stack)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
+
+// Format implements fmt.Formatter, %+v prints caller, stack and cause chain
+func (self *Error) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		io.WriteString(s, self.msg)
+		if !s.Flag('+') {
+			return
+		}
+		fmt.Fprintf(s, "\n\tat %s", self.Caller())
+		if len(self.stack) > 0 {
+			fmt.Fprintf(s, "\n%s", strings.TrimRight(self.Stack(), "\n"))
+		}
+		var cause *Error
+		if errors.As(self.cause, &cause) {
+			fmt.Fprintf(s, "\ncaused by: %+v", cause)
+		}
+	case 's':
+		io.WriteString(s, self.msg)
+	case 'q':
+		fmt.Fprintf(s, "%q", self.msg)
+	default:
+		fmt.Fprintf(s, "%%!%c(*mgo.Error=%s)", verb, self.msg)
+	}
+}
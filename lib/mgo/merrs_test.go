@@ -0,0 +1,34 @@
+package mgo
+
+import (
+	"strings"
+	"testing"
+)
+
+func deepError(n int) error {
+	if n == 0 {
+		return NewError("deep")
+	}
+	return deepError(n - 1)
+}
+
+func TestErrorStack(t *testing.T) {
+	e := deepError(50).(*Error)
+	if e.stack != nil || e.Stack() != "" {
+		t.Errorf("stack recorded while disabled")
+	}
+	if !strings.HasSuffix(e.Func, "deepError") {
+		t.Errorf("caller %s", e.Caller())
+	}
+
+	SetErrorStack(true)
+	defer SetErrorStack(false)
+	e = deepError(50).(*Error)
+	stack := e.Stack()
+	if n := strings.Count(stack, "deepError"); n != 51 {
+		t.Errorf("%d deepError frames in stack, want 51", n)
+	}
+	if first := strings.SplitN(stack, "\n", 2)[0]; !strings.HasSuffix(first, "deepError") {
+		t.Errorf("stack starts with %s", first)
+	}
+}
@@ -0,0 +1,261 @@
+package mgo
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Gls is goroutine-local key-value store keyed by GoId
+// values are copied to goroutines started by Go or GoFunc and removed
+// when their function returns, values set by other goroutines must be
+// deleted by Clear, or found by Leaks and removed by Reap after exit
+type Gls struct {
+	data  map[int64]map[string]interface{} // goroutine id -> values
+	mutex sync.RWMutex                     // lock: data
+}
+
+var (
+	glses    = []*Gls{} // stores copied by GoFunc
+	glsMutex = sync.Mutex{}
+)
+
+// NewGls create goroutine-local store, it is registered for GoFunc to copy
+// until Close, create stores once at package level, e.g.
+//
+//	var tenant = mgo.NewGls()
+func NewGls() *Gls {
+	g := &Gls{data: map[int64]map[string]interface{}{}}
+	glsMutex.Lock()
+	glses = append(glses, g)
+	glsMutex.Unlock()
+	return g
+}
+
+// Set set value of key in current goroutine
+func (self *Gls) Set(key string, value interface{}) {
+	gid := GoId()
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	m := self.data[gid]
+	if m == nil {
+		m = map[string]interface{}{}
+		self.data[gid] = m
+	}
+	m[key] = value
+}
+
+// Get returns value of key in current goroutine
+func (self *Gls) Get(key string) (interface{}, bool) {
+	gid := GoId()
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	v, ok := self.data[gid][key]
+	return v, ok
+}
+
+// Del delete key in current goroutine
+func (self *Gls) Del(key string) {
+	gid := GoId()
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if m := self.data[gid]; m != nil {
+		delete(m, key)
+		if len(m) == 0 {
+			delete(self.data, gid)
+		}
+	}
+}
+
+// Clear delete all values of current goroutine
+func (self *Gls) Clear() {
+	self.clear(GoId())
+}
+
+func (self *Gls) clear(gid int64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	delete(self.data, gid)
+}
+
+// Close unregister store from GoFunc and drop values of all goroutines
+// store can still be used by its own Go after Close
+func (self *Gls) Close() {
+	glsMutex.Lock()
+	for i, g := range glses {
+		if g == self {
+			glses = append(glses[:i:i], glses[i+1:]...)
+			break
+		}
+	}
+	glsMutex.Unlock()
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.data = map[int64]map[string]interface{}{}
+}
+
+// Len returns number of goroutines having values
+func (self *Gls) Len() int {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	return len(self.data)
+}
+
+// values returns copy of current goroutine's values
+func (self *Gls) values() map[string]interface{} {
+	gid := GoId()
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	if len(self.data[gid]) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(self.data[gid]))
+	for k, v := range self.data[gid] {
+		m[k] = v
+	}
+	return m
+}
+
+// install set copy of m as values of goroutine gid, returns cleanup func
+// removing all values of gid, also those set later by the goroutine itself
+func (self *Gls) install(gid int64, m map[string]interface{}) func() {
+	if len(m) > 0 {
+		c := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			c[k] = v
+		}
+		self.mutex.Lock()
+		self.data[gid] = c
+		self.mutex.Unlock()
+	}
+	return func() { self.clear(gid) }
+}
+
+// Go run fn in new goroutine with copy of current goroutine's values
+// values of the goroutine are removed when fn returns or panics
+func (self *Gls) Go(fn func()) {
+	m := self.values()
+	go func() {
+		defer self.install(GoId(), m)()
+		fn()
+	}()
+}
+
+// Leaks returns keys of goroutines which have exited but still have values
+func (self *Gls) Leaks() map[int64][]string {
+	alive := aliveGoIds()
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	leaks := map[int64][]string{}
+	for gid, m := range self.data {
+		if alive[gid] {
+			continue
+		}
+		for k := range m {
+			leaks[gid] = append(leaks[gid], k)
+		}
+	}
+	return leaks
+}
+
+// Reap remove values of exited goroutines, returns number of goroutines
+func (self *Gls) Reap() int {
+	alive := aliveGoIds()
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	num := 0
+	for gid := range self.data {
+		if !alive[gid] {
+			delete(self.data, gid)
+			num++
+		}
+	}
+	return num
+}
+
+// glsWrap returns func running fn with current goroutine's uuid and values
+// of all Gls, uuid and values of the goroutine are removed when fn returns
+// or panics, also those set by fn itself
+func glsWrap(fn func()) func() {
+	uuid := GetUuid()
+	glsMutex.Lock()
+	gs := append([]*Gls{}, glses...)
+	glsMutex.Unlock()
+	ms := make([]map[string]interface{}, len(gs))
+	for i, g := range gs {
+		ms[i] = g.values()
+	}
+
+	return func() {
+		gid := GoId()
+		if uuid != "" {
+			SetUuid(uuid)
+		}
+		defer DelUuid()
+		for i, g := range gs {
+			defer g.install(gid, ms[i])()
+		}
+		fn()
+	}
+}
+
+// UuidLeaks returns uuids of exited goroutines left in UuidCache
+func UuidLeaks() map[int64]string {
+	alive := aliveGoIds()
+	UuidMutex.RLock()
+	defer UuidMutex.RUnlock()
+	leaks := map[int64]string{}
+	for gid, uuid := range UuidCache {
+		if !alive[gid] {
+			leaks[gid] = uuid
+		}
+	}
+	return leaks
+}
+
+// ReapUuids remove uuids of exited goroutines from UuidCache, returns number
+func ReapUuids() int {
+	alive := aliveGoIds()
+	UuidMutex.Lock()
+	defer UuidMutex.Unlock()
+	num := 0
+	for gid := range UuidCache {
+		if !alive[gid] {
+			delete(UuidCache, gid)
+			num++
+		}
+	}
+	atomic.StoreInt32(&uuidSize, int32(len(UuidCache)))
+	return num
+}
+
+// aliveGoIds returns ids of all goroutines, it stops the world, call it rarely
+func aliveGoIds() map[int64]bool {
+	buf := make([]byte, 64*SIZE_1K)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	ids := map[int64]bool{}
+	prefix := []byte("goroutine ")
+	for _, line := range bytes.Split(buf, []byte("\n")) {
+		if !bytes.HasPrefix(line, prefix) {
+			continue
+		}
+		line = line[len(prefix):]
+		if i := bytes.IndexByte(line, ' '); i > 0 {
+			if gid, err := strconv.ParseInt(string(line[:i]), 10, 64); err == nil {
+				ids[gid] = true
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,76 @@
+package mgo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGls(t *testing.T) {
+	g := NewGls()
+	g.Set("tenant", "t1")
+	SetUuid("u-1")
+	defer DelUuid()
+
+	var tenant, uuid interface{}
+	GoFunc(1, func() {
+		tenant, _ = g.Get("tenant")
+		uuid = GetUuid()
+	}).Wait()
+	if tenant != "t1" || uuid != "u-1" {
+		t.Errorf("copied tenant %v uuid %v", tenant, uuid)
+	}
+	if g.Len() != 1 {
+		t.Errorf("values of finished goroutine left, len %d", g.Len())
+	}
+
+	g.Close()
+	if g.Len() != 0 {
+		t.Errorf("values left after Close")
+	}
+	glsMutex.Lock()
+	for _, gs := range glses {
+		if gs == g {
+			t.Errorf("store registered after Close")
+		}
+	}
+	glsMutex.Unlock()
+
+	g.Set("tenant", "t2")
+	tenant = nil
+	GoFunc(1, func() { tenant, _ = g.Get("tenant") }).Wait()
+	if tenant != nil {
+		t.Errorf("closed store copied by GoFunc")
+	}
+	g.Clear()
+}
+
+func TestGlsCleanupWithoutParentValues(t *testing.T) {
+	g := NewGls()
+	defer g.Close()
+
+	done := make(chan bool)
+	g.Go(func() {
+		g.Set("k", 1)
+		done <- true
+	})
+	<-done
+	GoFunc(2, func() {
+		g.Set("k", 2)
+		SetUuid("inner")
+	}).Wait()
+
+	deadline := time.Now().Add(time.Second)
+	for g.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if g.Len() != 0 {
+		t.Errorf("values left by goroutines: %v", g.Leaks())
+	}
+	UuidMutex.RLock()
+	defer UuidMutex.RUnlock()
+	for gid, uuid := range UuidCache {
+		if uuid == "inner" {
+			t.Errorf("uuid left by goroutine %d", gid)
+		}
+	}
+}
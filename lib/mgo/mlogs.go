@@ -1,199 +1,1182 @@
 package mgo
 
 import (
-	"errors"
+	"context"
+	"encoding/json"
 	"fmt"
-	"io"
 	"os"
 	"path"
+	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
-// mutex deadlock with dirty
+// Level is log level
+type Level int32
+
+const (
+	LevelUnset Level = iota - 1 // named logger inherits level from parent
+	LevelDebug
+	LevelInfo
+	LevelError
+	LevelFatal
+)
+
+var levelNames = []string{"DEBUG", "INFOF", "ERROR", "FATAL"}
+
+func (self Level) String() string {
+	if self == LevelUnset {
+		return "UNSET"
+	}
+	if self < LevelDebug || self > LevelFatal {
+		return fmt.Sprintf("LEVEL%d", self)
+	}
+	return levelNames[self]
+}
+
+// ParseLevel parse level name, e.g. debug/info/infof/error/fatal/unset
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "DEBUG":
+		return LevelDebug, nil
+	case "INFO", "INFOF":
+		return LevelInfo, nil
+	case "ERROR":
+		return LevelError, nil
+	case "FATAL":
+		return LevelFatal, nil
+	case "UNSET":
+		return LevelUnset, nil
+	}
+	return LevelDebug, fmt.Errorf("invalid log level %q", s)
+}
+
+// EnvLevel returns level set by env LOG_LEVEL_ENV, or def if not set
+func EnvLevel(def Level) Level {
+	s := os.Getenv(LOG_LEVEL_ENV)
+	if s == "" {
+		return def
+	}
+	level, err := ParseLevel(s)
+	if err != nil {
+		return def
+	}
+	return level
+}
+
+// Field is a key-value pair attached to a log line
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Entry is a log line before formatting
+type Entry struct {
+	Time   time.Time
+	Level  Level
+	PC     uintptr // caller program counter, 0 means unknown
+	File   string  // caller file base name
+	Func   string  // caller function name
+	Line   int     // caller line number
+	Uuid   string
+	Cache  int // uuid-cache size
+	Msg    string
+	Fields []Field
+}
+
+// Formatter append formatted entry to b, without tailing newline
+type Formatter func(b []byte, e *Entry) []byte
+
+// Logger format entries and write them to sinks
 type Logger struct {
-	pre  string // log filename prefix, empty pre means log to stdio
-	max  int64  // log file max size
-	sync bool   // log sync mode
+	name   string       // dotted name, e.g. "http.client", empty for root logger
+	level  int32        // atomic min level, LevelUnset means inherit from parent
+	format atomic.Value // Formatter, line format, nil means inherit from parent
+
+	sinks  []*sinkConf  // log outputs, lines are also written to parent's sinks
+	smutex sync.RWMutex // lock: sinks
 
-	fio io.ReadWriteCloser // log file handler
-	num int64              // log file size, num=-1 indicate fio not open
+	parent *Logger // child logger writes through parent
+	fields []Field // fields attached to each line
 
-	buf   []byte     // log buf
-	mutex sync.Mutex // lock: buf
+	skip     int  // extra caller frames to skip, for logging wrappers
+	nocaller bool // skip caller lookup, file:func():line is empty
+
+	redactor atomic.Value // *redactor, secrets masked before lines reach sinks
+	rmutex   sync.Mutex   // lock: redactor update
+	sampler  atomic.Value // *sampler, per call site sampling, nil means inherit
+}
 
-	dirty chan bool // log buf is dirty
+type sinkConf struct {
+	sink   Sink
+	level  Level     // sink min level
+	format Formatter // sink line format, nil means logger's format
 }
 
-func (self *Logger) close() {
-	if self.fio != nil {
-		self.fio.Close()
+// AddSink attach sink to logger, lines below level are not written to sink
+// f is sink's line format, nil means logger's format
+func (self *Logger) AddSink(s Sink, level Level, f Formatter) {
+	if fs, ok := s.(formatSink); ok {
+		if f != nil {
+			fs.setFormat(f)
+		} else {
+			fs.setFormat(self.getFormat())
+		}
 	}
-	self.fio = nil
-	self.num = -1
+	self.smutex.Lock()
+	defer self.smutex.Unlock()
+	self.sinks = append(self.sinks, &sinkConf{sink: s, level: level, format: f})
+}
+
+// formatSink is sink writing its own lines, e.g. drop report of FileSink
+type formatSink interface {
+	setFormat(f Formatter)
 }
 
-func (self *Logger) open() error {
-	if self.pre == "" {
-		return nil
+// RemoveSink detach sink from logger, sink is not closed
+func (self *Logger) RemoveSink(s Sink) bool {
+	self.smutex.Lock()
+	defer self.smutex.Unlock()
+	for i, sc := range self.sinks {
+		if sc.sink == s {
+			self.sinks = append(self.sinks[:i:i], self.sinks[i+1:]...)
+			return true
+		}
 	}
+	return false
+}
 
-	if self.fio != nil && self.num >= 0 && self.num < self.max {
-		return nil
+// Sinks returns logger's own sinks, parent's sinks are not included
+func (self *Logger) Sinks() []Sink {
+	ss := []Sink{}
+	for _, sc := range self.getSinks() {
+		ss = append(ss, sc.sink)
 	}
+	return ss
+}
 
-	if self.num > self.max {
-		self.close()
+func (self *Logger) getSinks() []*sinkConf {
+	self.smutex.RLock()
+	defer self.smutex.RUnlock()
+	return self.sinks
+}
+
+// allSinks returns sinks of logger and its parents
+func (self *Logger) allSinks() []*sinkConf {
+	scs := []*sinkConf{}
+	for l := self; l != nil; l = l.up() {
+		scs = append(scs, l.getSinks()...)
 	}
+	return scs
+}
 
-	fname := fmt.Sprintf("%s-%s", self.pre, time.Now().Format("2006010215"))
-	if PathExist(fname) && FileSize(fname) > self.max - self.num {
-		fname = fmt.Sprintf("%s-%s", self.pre, time.Now().Format("2006010215.0405"))
-		if PathExist(fname) {
-			fname = fmt.Sprintf("%s-%s", self.pre, time.Now().Format("2006010215.0405.000"))
+// Write write raw info to all sinks
+// info is masked by redaction patterns
+func (self *Logger) Write(info string) error {
+	info = self.redactLine(info)
+	var rerr error
+	for _, sc := range self.allSinks() {
+		if err := sc.sink.Write([]byte(info)); err != nil && rerr == nil {
+			rerr = err
 		}
 	}
-	err := CreateFile(fname)
-	if err != nil {
-		return err
+	return rerr
+}
+
+// Flush write pending lines of all sinks, including parent's
+func (self *Logger) Flush() error {
+	var rerr error
+	for _, sc := range self.allSinks() {
+		if err := sc.sink.Flush(); err != nil && rerr == nil {
+			rerr = err
+		}
 	}
-	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_APPEND, 0644)
-	if err != nil {
+	return rerr
+}
+
+// Close flush and close own sinks, returns error if not finished in timeout
+func (self *Logger) Close(timeout time.Duration) error {
+	done := make(chan error, 1)
+	go func() {
+		var rerr error
+		for _, sc := range self.getSinks() {
+			if err := sc.sink.Close(); err != nil && rerr == nil {
+				rerr = err
+			}
+		}
+		done <- rerr
+	}()
+
+	select {
+	case err := <-done:
 		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("close logger timeout after %v", timeout)
 	}
-	self.fio = f
-	self.num = 0
-	return nil
 }
-func (self *Logger) openAndLog() {
-	if self.pre == "" {
-		panic("missing log file")
+
+// NewLogger create new logger, min level is set by env LOG_LEVEL_ENV
+func NewLogger(sync bool, pre string, size int64) *Logger {
+	return NewLevelLogger(sync, pre, size, EnvLevel(LevelDebug))
+}
+
+// NewLevelLogger create new logger with min level
+// empty pre means log to stdout, otherwise log to file sink
+func NewLevelLogger(sync bool, pre string, size int64, level Level) *Logger {
+	logger := &Logger{level: int32(level)}
+	logger.SetFormat(TextFormatter)
+
+	if pre == "" {
+		logger.AddSink(NewWriterSink(os.Stdout), LevelDebug, nil)
+	} else {
+		logger.AddSink(NewFileSink(sync, pre, size), LevelDebug, nil)
 	}
 
-	err := self.open()
-	if err != nil {
-		panic(err)
+	return logger
+}
+
+// InitGlogger init global logger once
+// logging or setting global logger before init uses a stdout logger, it is
+// replaced here with its level, format, redaction, sampling and added sinks
+func InitGlogger(sync bool, pre string, size int64) {
+	glogOnce.Do(func() {
+		l := NewLogger(sync, pre, size)
+		glogMutex.Lock()
+		defer glogMutex.Unlock()
+		if glogDef != nil {
+			l.takeOver(glogDef, glogStd)
+			glogDef, glogStd = nil, nil
+		}
+		glog.Store(l)
+	})
+}
+
+// takeOver copy settings and sinks except skip of logger d, stop its sampling
+func (self *Logger) takeOver(d *Logger, skip Sink) {
+	atomic.StoreInt32(&self.level, atomic.LoadInt32(&d.level))
+	if f, _ := d.format.Load().(Formatter); f != nil {
+		self.SetFormat(f)
+	}
+	if r := d.getRedactor(); r != nil {
+		self.redactor.Store(r)
+	}
+	if s, _ := d.sampler.Load().(*sampler); s != nil {
+		self.SetSampling(s.interval, s.first, s.thereafter)
+		d.SetSampling(0, 0, 0)
+	}
+	for _, sc := range d.getSinks() {
+		if sc.sink != skip {
+			self.AddSink(sc.sink, sc.level, sc.format)
+		}
+	}
+}
+
+func InitLogger(pre string) {
+	InitGlogger(true, pre, 100*SIZE_1M)
+}
+
+var (
+	loggers     = map[string]*Logger{} // named loggers
+	loggerMutex = sync.Mutex{}         // lock: loggers
+	loggerOnce  = sync.Once{}          // load levels from env LOG_LEVELS_ENV
+)
+
+// GetLogger returns named logger, create it if not exist
+// "a.b" is child of "a", top named loggers are children of global logger
+// named logger inherits level, format and sinks from parent
+func GetLogger(name string) *Logger {
+	loggerOnce.Do(func() {
+		SetLoggerLevels(os.Getenv(LOG_LEVELS_ENV))
+	})
+	return getLogger(name)
+}
+
+func getLogger(name string) *Logger {
+	name = strings.Trim(name, ".")
+	if name == "" {
+		return glogger()
+	}
+
+	loggerMutex.Lock()
+	l, ok := loggers[name]
+	loggerMutex.Unlock()
+	if ok {
+		return l
+	}
+
+	var parent *Logger
+	if i := strings.LastIndex(name, "."); i > 0 {
+		parent = getLogger(name[:i])
 	}
 
-	if self.num < 0 {
-		panic("fio not open")
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+	if l, ok := loggers[name]; ok {
+		return l
+	}
+	l = &Logger{
+		name:   name,
+		level:  int32(LevelUnset),
+		parent: parent,
+		fields: []Field{{"logger", name}},
 	}
+	loggers[name] = l
+	return l
+}
 
-	self.mutex.Lock()
-	if len(self.buf) > 0 {
-		n, err := self.fio.Write(self.buf)
+// LoggerNames returns sorted names of named loggers
+func LoggerNames() []string {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+	names := []string{}
+	for name := range loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetLoggerLevel set named logger's level, empty name means global logger
+func SetLoggerLevel(name string, level Level) {
+	GetLogger(name).SetLevel(level)
+}
+
+// SetLoggerLevels set levels by spec "name=level,...", e.g.
+// "http=debug,http.client=error,db=unset", empty name means global logger
+func SetLoggerLevels(spec string) error {
+	for _, item := range strings.Split(spec, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid logger level %q", item)
+		}
+		level, err := ParseLevel(kv[1])
 		if err != nil {
-			panic(err)
+			return err
 		}
-		self.buf = []byte{}
-		self.num += int64(n)
+		getLogger(strings.TrimSpace(kv[0])).SetLevel(level)
 	}
-	self.mutex.Unlock()
+	return nil
 }
 
-func (self *Logger) flush() error {
-	for {
-		select {
-		case <-self.dirty:
-			self.openAndLog()
+// glogger returns global logger, a stdout logger is used until InitGlogger
+// replaces it, glogOnce is kept for InitGlogger
+func glogger() *Logger {
+	if l := loadGlogger(); l != nil {
+		return l
+	}
+	d := NewLogger(true, "", 100*SIZE_1M)
+	glogMutex.Lock()
+	defer glogMutex.Unlock()
+	if l := loadGlogger(); l != nil {
+		return l
+	}
+	glogDef, glogStd = d, d.Sinks()[0]
+	glog.Store(d)
+	return d
+}
+
+// Glog returns global logger, it replaces removed Glogger variable
+// a stdout logger is returned before InitGlogger, do not keep it
+func Glog() *Logger {
+	return glogger()
+}
+
+func loadGlogger() *Logger {
+	l, _ := glog.Load().(*Logger)
+	return l
+}
+
+// up returns parent logger, top named loggers' parent is global logger
+func (self *Logger) up() *Logger {
+	if self.parent != nil {
+		return self.parent
+	}
+	if self.name != "" {
+		return glogger()
+	}
+	return nil
+}
+
+// Name returns logger's name, empty for root logger
+func (self *Logger) Name() string {
+	return self.name
+}
+
+// SetFormat set line format at runtime, e.g. TextFormatter or JsonFormatter
+// nil means inherit from parent
+func (self *Logger) SetFormat(f Formatter) {
+	self.format.Store(f)
+	for _, sc := range self.getSinks() {
+		if fs, ok := sc.sink.(formatSink); ok && sc.format == nil {
+			fs.setFormat(self.getFormat())
 		}
 	}
 }
-func (self *Logger) Write(info string) error {
-	if self.pre == "" {
-		fmt.Printf(info)
-		return nil
+
+func (self *Logger) getFormat() Formatter {
+	for l := self; l != nil; l = l.up() {
+		if f, _ := l.format.Load().(Formatter); f != nil {
+			return f
+		}
+	}
+	return TextFormatter
+}
+
+// SetLevel set min level at runtime, fatal lines are always logged
+// LevelUnset means inherit level from parent
+func (self *Logger) SetLevel(level Level) {
+	if level > LevelFatal {
+		level = LevelFatal
 	}
+	if level < LevelUnset {
+		level = LevelUnset
+	}
+	atomic.StoreInt32(&self.level, int32(level))
+}
 
-	self.mutex.Lock()
-	self.buf = append(self.buf, []byte(info)...)
-	self.mutex.Unlock()
+// OwnLevel returns level set on logger itself, LevelUnset if inherited
+func (self *Logger) OwnLevel() Level {
+	return Level(atomic.LoadInt32(&self.level))
+}
 
-	if self.sync {
-		self.openAndLog()
-		self.close()
-	} else {
-		self.dirty <- true
+// GetLevel returns min level, inherited from parent if not set
+func (self *Logger) GetLevel() Level {
+	for l := self; l != nil; l = l.up() {
+		if level := Level(atomic.LoadInt32(&l.level)); level != LevelUnset {
+			return level
+		}
 	}
-	return nil
+	return LevelDebug
 }
 
-// NewLogger create new logger
-func NewLogger(sync bool, pre string, size int64) *Logger {
-	logger := &Logger{
-		sync:  sync,
-		pre:   pre,
-		max:   size,
-		num:   -1,
-		dirty: make(chan bool, SIZE_1K),
+// Enabled check if level will be logged
+func (self *Logger) Enabled(level Level) bool {
+	return level >= self.GetLevel()
+}
+
+// With returns child logger which attach fields to each line
+// kv format: "k1", v1, "k2", v2 or Field{}
+func (self *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]Field, 0, len(self.fields)+len(kv)/2)
+	fields = append(fields, self.fields...)
+	return &Logger{
+		name:     self.name,
+		level:    int32(LevelUnset),
+		parent:   self,
+		fields:   append(fields, fieldsOf(kv)...),
+		skip:     self.skip,
+		nocaller: self.nocaller,
 	}
+}
 
-	if !sync {
-		go logger.flush()
+// WithCallerSkip returns child logger which skips n more caller frames
+// used by wrappers of logger to report wrapper's caller
+func (self *Logger) WithCallerSkip(n int) *Logger {
+	l := self.With()
+	l.skip += n
+	return l
+}
+
+// WithoutCaller returns child logger which does not lookup caller, for hot path
+func (self *Logger) WithoutCaller() *Logger {
+	l := self.With()
+	l.nocaller = true
+	return l
+}
+
+var (
+	helpers    = sync.Map{} // func name -> true, marked by MarkHelper
+	helperSize = int32(0)   // atomic number of helpers
+)
+
+// MarkHelper mark calling function as logging helper
+// like testing.T.Helper, helper frames are skipped when reporting caller
+func MarkHelper() {
+	pcs := [1]uintptr{}
+	runtime.Callers(2, pcs[:])
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	if _, loaded := helpers.LoadOrStore(frame.Function, true); !loaded {
+		atomic.AddInt32(&helperSize, 1)
 	}
+}
 
-	return logger
+// caller is source location of a pc
+type caller struct {
+	file string // base name of file
+	fn   string
+	line int
 }
 
-// InitLogger init global logger
-func InitGlogger(sync bool, pre string, size int64) {
-	once.Do(func() {
-		Glogger = NewLogger(sync, pre, size)
-	})
+var (
+	callers      atomic.Value // map[uintptr]*caller, copied on write
+	callersMutex sync.Mutex
+	noCaller     = &caller{}
+)
+
+// callerOf returns cached caller of pc, pc is from runtime.Callers
+// inlined pc reports innermost function like runtime.CallersFrames
+func callerOf(pc uintptr) *caller {
+	m, _ := callers.Load().(map[uintptr]*caller)
+	if c, ok := m[pc]; ok {
+		return c
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	c := &caller{file: path.Base(frame.File), fn: frame.Function, line: frame.Line}
+
+	callersMutex.Lock()
+	defer callersMutex.Unlock()
+	m, _ = callers.Load().(map[uintptr]*caller)
+	n := make(map[uintptr]*caller, len(m)+1)
+	for k, v := range m {
+		n[k] = v
+	}
+	n[pc] = c
+	callers.Store(n)
+	return c
 }
 
-func InitLogger(pre string) {
-	InitGlogger(true, pre, 100*SIZE_1M)
+func isHelper(fn string) bool {
+	_, ok := helpers.Load(fn)
+	return ok
 }
 
-func logwrite(s string) {
-	if Glogger == nil {
-		InitLogger("")
+// callerFrame returns pc and caller, helper frames are skipped
+// skip is caller depth of callerFrame
+func callerFrame(skip int) (uintptr, *caller) {
+	if atomic.LoadInt32(&helperSize) > 0 {
+		return helperCaller(skip + 1)
 	}
+	pcs := [1]uintptr{}
+	if runtime.Callers(skip+1, pcs[:]) == 0 {
+		return 0, noCaller
+	}
+	return pcs[0], callerOf(pcs[0])
+}
 
-	Glogger.Write(s + "\n")
+// helperCaller is callerFrame when helpers are marked, pcs escapes here
+func helperCaller(skip int) (uintptr, *caller) {
+	pcs := [1]uintptr{}
+	for i := skip + 1; runtime.Callers(i, pcs[:]) > 0; i++ {
+		if c := callerOf(pcs[0]); !isHelper(c.fn) {
+			return pcs[0], c
+		}
+		// helper may be inlined into its caller
+		frames := runtime.CallersFrames(pcs[:])
+		for {
+			frame, more := frames.Next()
+			if !isHelper(frame.Function) {
+				return pcs[0], &caller{file: path.Base(frame.File), fn: frame.Function, line: frame.Line}
+			}
+			if !more {
+				break
+			}
+		}
+	}
+	return 0, noCaller
+}
+
+func fieldsOf(kv []interface{}) []Field {
+	fields := make([]Field, 0, len(kv))
+	for i := 0; i < len(kv); i++ {
+		if f, ok := kv[i].(Field); ok {
+			fields = append(fields, f)
+			continue
+		}
+		if i == len(kv)-1 {
+			fields = append(fields, Field{"EXTRA", kv[i]})
+			break
+		}
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprintf("%v", kv[i])
+		}
+		fields = append(fields, Field{key, kv[i+1]})
+		i++
+	}
+	return fields
 }
 
 // support format
-// 1. logf(s)
-// 2. logf(fmt, v...)
-// 3. logf(any, v...)
-func logf(level string, f interface{}, args ...interface{}) string {
+// 1. sprintf(s)
+// 2. sprintf(fmt, v...)
+// 3. sprintf(any, v...)
+func sprintf(f interface{}, args ...interface{}) string {
 	fs, ok := f.(string)
+	if ok && len(args) == 0 && strings.IndexByte(fs, '%') < 0 {
+		return strings.TrimSpace(fs)
+	}
 	if !ok {
 		fs = fmt.Sprintf("%v", f) + strings.Repeat(" [%v]", len(args))
 	}
+	return strings.TrimSpace(fmt.Sprintf(fs, args...))
+}
+
+// output format and write entry, depth is caller depth of output
+// uuid is taken from ctx, then from current goroutine, ctx can be nil
+// lines over sampling limit of call site are dropped, fatal lines are not
+func (self *Logger) output(ctx context.Context, depth int, level Level, msg string, fields []Field) {
+	s := self.getSampler()
+	pc, c := uintptr(0), noCaller
+	if !self.nocaller || s != nil {
+		pc, c = callerFrame(depth + 1 + self.skip)
+	}
+	if s != nil && level < LevelFatal && !s.allow(pc, c, level) {
+		return
+	}
+
+	e := entryPool.Get().(*Entry)
+	*e = Entry{
+		Time:   time.Now(),
+		Level:  level,
+		Msg:    msg,
+		Fields: fields,
+	}
+	if !self.nocaller {
+		e.PC = pc
+		e.File = c.file
+		e.Func = c.fn
+		e.Line = c.line
+	}
+	if uuid := ctxUuid(ctx); uuid != "" {
+		e.Uuid = uuid
+		e.Cache = UuidCacheSize()
+	}
+	self.write(e)
+
+	*e = Entry{}
+	entryPool.Put(e)
+}
+
+// write attach logger's fields to entry, format and write it to sinks
+// EntrySink receives entry instead of formatted line
+func (self *Logger) write(e *Entry) {
+	if len(self.fields) > 0 {
+		fields := make([]Field, 0, len(self.fields)+len(e.Fields))
+		e.Fields = append(append(fields, self.fields...), e.Fields...)
+	}
+	self.redactEntry(e)
+
+	// line of logger's format is formatted once and shared by sinks
+	var line *[]byte
+	for l := self; l != nil; l = l.up() {
+		for _, sc := range l.getSinks() {
+			if e.Level < sc.level {
+				continue
+			}
+			if es, ok := sc.sink.(EntrySink); ok {
+				es.WriteEntry(e)
+				continue
+			}
+			if sc.format != nil {
+				b := getBuf()
+				*b = append(sc.format(*b, e), '\n')
+				sc.sink.Write(*b)
+				putBuf(b)
+				continue
+			}
+			if line == nil {
+				line = getBuf()
+				*line = append(self.getFormat()(*line, e), '\n')
+			}
+			sc.sink.Write(*line)
+		}
+	}
+	if line != nil {
+		putBuf(line)
+	}
+}
+
+var (
+	entryPool = sync.Pool{New: func() interface{} { return &Entry{} }}
+	bufPool   = sync.Pool{New: func() interface{} { b := make([]byte, 0, SIZE_1K); return &b }}
+)
+
+func getBuf() *[]byte {
+	b := bufPool.Get().(*[]byte)
+	*b = (*b)[:0]
+	return b
+}
+
+// putBuf return buf to pool, large buf is dropped to bound memory
+func putBuf(b *[]byte) {
+	if cap(*b) <= 64*SIZE_1K {
+		bufPool.Put(b)
+	}
+}
+
+func (self *Logger) logf(ctx context.Context, level Level, f interface{}, args ...interface{}) {
+	if !self.Enabled(level) {
+		return
+	}
+	self.output(ctx, 3, level, sprintf(f, args...), nil)
+}
+
+func (self *Logger) logw(ctx context.Context, level Level, msg string, kv []interface{}) {
+	if !self.Enabled(level) {
+		return
+	}
+	self.output(ctx, 3, level, msg, fieldsOf(kv))
+}
+
+// loge log err with error level, returns rich error of caller
+// skip is extra caller frames to skip, 0 means caller of loge's caller
+func (self *Logger) loge(ctx context.Context, skip int, msg string, cause error, fields []Field) *Error {
+	e := newError(3+skip+self.skip, msg, cause, errorStackOn())
+	if self.Enabled(LevelError) {
+		self.output(ctx, 3+skip, LevelError, e.msg, fields)
+	}
+	return e
+}
+
+// fatal log fatal error with stack, flush logger and handle it by fatal policy
+func (self *Logger) fatal(ctx context.Context, skip int, msg string, cause error, fields []Field) {
+	e := newError(3+skip+self.skip, msg, cause, true)
+	self.output(ctx, 3+skip, LevelFatal, e.msg, fields)
+	self.Flush()
+	handleFatal(e)
+}
+
+// TextFormatter format line as
+// [time] LEVEL file:func():line uuid (cache) msg k1=v1 k2=v2
+func TextFormatter(b []byte, e *Entry) []byte {
+	b = append(b, '[')
+	b = appendTime(b, e.Time)
+	b = append(b, "] "...)
+	b = append(b, e.Level.String()...)
+	b = append(b, ' ')
+	b = append(b, e.File...)
+	b = append(b, ':')
+	b = append(b, e.Func...)
+	b = append(b, "():"...)
+	b = strconv.AppendInt(b, int64(e.Line), 10)
+	b = append(b, ' ')
+	if e.Uuid != "" {
+		b = append(b, e.Uuid...)
+		b = append(b, " ("...)
+		b = strconv.AppendInt(b, int64(e.Cache), 10)
+		b = append(b, ") "...)
+	}
+	b = append(b, e.Msg...)
+	for _, f := range e.Fields {
+		b = append(b, ' ')
+		b = append(b, f.Key...)
+		b = append(b, '=')
+		b = appendText(b, f.Value)
+	}
+	return b
+}
 
-	pc, file, line, _ := runtime.Caller(2)
-	key := fmt.Sprintf("[%s] %s %s:%s():%d ", time.Now().Format(TIME_FORMAT),
-		level, path.Base(file), runtime.FuncForPC(pc).Name(), line)
-	if uuid := GetUuid(); uuid != "" {
-		key += fmt.Sprintf("%s (%d) ", uuid, UuidCacheSize())
+// appendTime append t in TIME_FORMAT, faster than t.AppendFormat
+func appendTime(b []byte, t time.Time) []byte {
+	year, month, day := t.Date()
+	hour, min, sec := t.Clock()
+	b = appendDigits(b, year, 4)
+	b = append(b, '-')
+	b = appendDigits(b, int(month), 2)
+	b = append(b, '-')
+	b = appendDigits(b, day, 2)
+	b = append(b, ' ')
+	b = appendDigits(b, hour, 2)
+	b = append(b, ':')
+	b = appendDigits(b, min, 2)
+	b = append(b, ':')
+	b = appendDigits(b, sec, 2)
+	b = append(b, '.')
+	return appendDigits(b, t.Nanosecond()/1e6, 3)
+}
+
+// appendDigits append n with leading zeros to width
+func appendDigits(b []byte, n int, width int) []byte {
+	var buf [8]byte
+	i := len(buf)
+	for ; width > 0 || n > 0; width-- {
+		i--
+		buf[i] = byte('0' + n%10)
+		n /= 10
 	}
+	return append(b, buf[i:]...)
+}
 
-	s := strings.TrimSpace(fmt.Sprintf(fs, args...))
-	logwrite(key + s)
-	return s
+// appendText append value as %v, quoted if empty or containing separators
+func appendText(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		if v == "" || strings.ContainsAny(v, " =\"\t\n") {
+			return strconv.AppendQuote(b, v)
+		}
+		return append(b, v...)
+	case int:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(b, v, 10)
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10)
+	case uint:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint(b, v, 10)
+	case uint32:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case float64:
+		return strconv.AppendFloat(b, v, 'g', -1, 64)
+	case bool:
+		return strconv.AppendBool(b, v)
+	}
+	return appendText(b, fmt.Sprintf("%v", v))
+}
+
+// JsonFormatter format line as one json object
+// {"time":"","level":"","caller":"","uuid":"","cache":0,"msg":"",k1:v1}
+func JsonFormatter(b []byte, e *Entry) []byte {
+	b = append(b, `{"time":"`...)
+	b = appendTime(b, e.Time)
+	b = append(b, `","level":"`...)
+	b = append(b, e.Level.String()...)
+	b = append(b, `","caller":"`...)
+	b = appendJsonChars(b, e.File)
+	b = append(b, ':')
+	b = appendJsonChars(b, e.Func)
+	b = append(b, "():"...)
+	b = strconv.AppendInt(b, int64(e.Line), 10)
+	b = append(b, '"')
+	if e.Uuid != "" {
+		b = append(b, `,"uuid":`...)
+		b = appendJsonString(b, e.Uuid)
+		b = append(b, `,"cache":`...)
+		b = strconv.AppendInt(b, int64(e.Cache), 10)
+	}
+	b = append(b, `,"msg":`...)
+	b = appendJsonString(b, e.Msg)
+	for _, f := range e.Fields {
+		b = append(b, ',')
+		b = appendJsonString(b, f.Key)
+		b = append(b, ':')
+		b = appendJson(b, f.Value)
+	}
+	return append(b, '}')
+}
+
+var (
+	textLineRe = regexp.MustCompile(
+		`^\[([0-9-]{10} [0-9:.]{12})\] (\S+) (\S*?):(\S*)\(\):(\d+) (?:(\S+) \((\d+)\) )?(.*)$`)
+	callerRe = regexp.MustCompile(`^(\S*?):(\S*)\(\):(\d+)$`)
+)
+
+// ParseLine parse line formatted by TextFormatter or JsonFormatter
+// audit suffix of AuditSink line is ignored
+// fields of text line are kept in Msg, fields of json line are sorted by key
+func ParseLine(line string) (*Entry, error) {
+	line = stripAudit(strings.TrimRight(line, "\r\n"))
+	if strings.HasPrefix(line, "{") {
+		return parseJsonLine(line)
+	}
+
+	m := textLineRe.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("invalid log line %q", line)
+	}
+	t, err := time.ParseInLocation(TIME_FORMAT, m[1], time.Local)
+	if err != nil {
+		return nil, err
+	}
+	level, err := ParseLevel(m[2])
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{Time: t, Level: level, File: m[3], Func: m[4], Uuid: m[6], Msg: m[8]}
+	e.Line, _ = strconv.Atoi(m[5])
+	e.Cache, _ = strconv.Atoi(m[7])
+	return e, nil
+}
+
+func parseJsonLine(line string) (*Entry, error) {
+	m := map[string]interface{}{}
+	d := json.NewDecoder(strings.NewReader(line))
+	d.UseNumber()
+	if err := d.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	str := func(k string) string {
+		s, _ := m[k].(string)
+		delete(m, k)
+		return s
+	}
+	t, err := time.ParseInLocation(TIME_FORMAT, str("time"), time.Local)
+	if err != nil {
+		return nil, err
+	}
+	level, err := ParseLevel(str("level"))
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{Time: t, Level: level, Uuid: str("uuid"), Msg: str("msg")}
+	if c := callerRe.FindStringSubmatch(str("caller")); c != nil {
+		e.File, e.Func = c[1], c[2]
+		e.Line, _ = strconv.Atoi(c[3])
+	}
+	if n, ok := m["cache"].(json.Number); ok {
+		c, _ := n.Int64()
+		e.Cache = int(c)
+		delete(m, "cache")
+	}
+	for _, k := range MapKeys(m) {
+		e.Fields = append(e.Fields, Field{k.(string), m[k.(string)]})
+	}
+	return e, nil
+}
+
+func appendJson(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case string:
+		return appendJsonString(b, v)
+	case error:
+		return appendJsonString(b, v.Error())
+	case int:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(b, v, 10)
+	case uint64:
+		return strconv.AppendUint(b, v, 10)
+	case bool:
+		return strconv.AppendBool(b, v)
+	}
+	js, err := json.Marshal(v)
+	if err != nil {
+		js, _ = json.Marshal(fmt.Sprintf("%v", v))
+	}
+	return append(b, js...)
+}
+
+// appendJsonString append s as json string, invalid utf-8 is replaced by \ufffd
+func appendJsonString(b []byte, s string) []byte {
+	b = append(b, '"')
+	b = appendJsonChars(b, s)
+	return append(b, '"')
+}
+
+// appendJsonChars append escaped s without quotes
+func appendJsonChars(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				b = append(b, s[start:i]...)
+				b = append(b, `\ufffd`...)
+				i += size
+				start = i
+				continue
+			}
+			i += size
+			continue
+		}
+		if c >= 0x20 && c != '"' && c != '\\' {
+			i++
+			continue
+		}
+		b = append(b, s[start:i]...)
+		switch c {
+		case '"', '\\':
+			b = append(b, '\\', c)
+		case '\n':
+			b = append(b, '\\', 'n')
+		case '\r':
+			b = append(b, '\\', 'r')
+		case '\t':
+			b = append(b, '\\', 't')
+		default:
+			b = append(b, `\u00`...)
+			b = append(b, hex[c>>4], hex[c&0xf])
+		}
+		i++
+		start = i
+	}
+	return append(b, s[start:]...)
+}
+
+// Debugf log with debug level
+func (self *Logger) Debugf(f interface{}, args ...interface{}) {
+	self.logf(nil, LevelDebug, f, args...)
+}
+
+// Infof log with info level
+func (self *Logger) Infof(f interface{}, args ...interface{}) {
+	self.logf(nil, LevelInfo, f, args...)
+}
+
+// Errorf log with error level, returns *Error supports %w wrapping
+func (self *Logger) Errorf(f interface{}, args ...interface{}) error {
+	msg, cause := errorOf(f, args...)
+	return self.loge(nil, 0, msg, cause, nil)
+}
+
+// Fatalf log with fatal level, then handle by fatal policy
+func (self *Logger) Fatalf(f interface{}, args ...interface{}) {
+	msg, cause := errorOf(f, args...)
+	self.fatal(nil, 0, msg, cause, nil)
+}
+
+// Debugw log msg and key-values with debug level
+func (self *Logger) Debugw(msg string, kv ...interface{}) {
+	self.logw(nil, LevelDebug, msg, kv)
+}
+
+// Infow log msg and key-values with info level
+func (self *Logger) Infow(msg string, kv ...interface{}) {
+	self.logw(nil, LevelInfo, msg, kv)
+}
+
+// Errorw log msg and key-values with error level
+func (self *Logger) Errorw(msg string, kv ...interface{}) error {
+	return self.loge(nil, 0, msg, nil, fieldsOf(kv))
+}
+
+// Fatalw log msg and key-values with fatal level, then handle by fatal policy
+func (self *Logger) Fatalw(msg string, kv ...interface{}) {
+	self.fatal(nil, 0, msg, nil, fieldsOf(kv))
+}
+
+// DebugfCtx log with debug level and ctx's request id
+func (self *Logger) DebugfCtx(ctx context.Context, f interface{}, args ...interface{}) {
+	self.logf(ctx, LevelDebug, f, args...)
+}
+
+// InfofCtx log with info level and ctx's request id
+func (self *Logger) InfofCtx(ctx context.Context, f interface{}, args ...interface{}) {
+	self.logf(ctx, LevelInfo, f, args...)
+}
+
+// ErrorfCtx log with error level and ctx's request id
+func (self *Logger) ErrorfCtx(ctx context.Context, f interface{}, args ...interface{}) error {
+	msg, cause := errorOf(f, args...)
+	return self.loge(ctx, 0, msg, cause, nil)
+}
+
+// FatalfCtx log with fatal level and ctx's request id, then handle by fatal policy
+func (self *Logger) FatalfCtx(ctx context.Context, f interface{}, args ...interface{}) {
+	msg, cause := errorOf(f, args...)
+	self.fatal(ctx, 0, msg, cause, nil)
 }
 
 // Debugf log with debug level
 func Debugf(f interface{}, args ...interface{}) {
-	logf("DEBUG", f, args...)
+	glogger().logf(nil, LevelDebug, f, args...)
 }
 
 // Infof log with info level
 func Infof(f interface{}, args ...interface{}) {
-	logf("INFOF", f, args...)
+	glogger().logf(nil, LevelInfo, f, args...)
 }
 
-// Errorf log with error level
+// Errorf log with error level, returns *Error supports %w wrapping
 func Errorf(f interface{}, args ...interface{}) error {
-	return errors.New(logf("ERROR", f, args...))
+	msg, cause := errorOf(f, args...)
+	return glogger().loge(nil, 0, msg, cause, nil)
 }
 
-// Fatalf log with fatal level
+// Fatalf log with fatal level, then handle by fatal policy
 func Fatalf(f interface{}, args ...interface{}) {
-	panic(logf("FATAL", f, args...))
+	msg, cause := errorOf(f, args...)
+	glogger().fatal(nil, 0, msg, cause, nil)
+}
+
+// Debugw log msg and key-values with debug level
+func Debugw(msg string, kv ...interface{}) {
+	glogger().logw(nil, LevelDebug, msg, kv)
+}
+
+// Infow log msg and key-values with info level
+func Infow(msg string, kv ...interface{}) {
+	glogger().logw(nil, LevelInfo, msg, kv)
+}
+
+// Errorw log msg and key-values with error level
+func Errorw(msg string, kv ...interface{}) error {
+	return glogger().loge(nil, 0, msg, nil, fieldsOf(kv))
+}
+
+// Fatalw log msg and key-values with fatal level, then handle by fatal policy
+func Fatalw(msg string, kv ...interface{}) {
+	glogger().fatal(nil, 0, msg, nil, fieldsOf(kv))
+}
+
+// DebugfCtx log with debug level and ctx's request id
+func DebugfCtx(ctx context.Context, f interface{}, args ...interface{}) {
+	glogger().logf(ctx, LevelDebug, f, args...)
+}
+
+// InfofCtx log with info level and ctx's request id
+func InfofCtx(ctx context.Context, f interface{}, args ...interface{}) {
+	glogger().logf(ctx, LevelInfo, f, args...)
+}
+
+// ErrorfCtx log with error level and ctx's request id
+func ErrorfCtx(ctx context.Context, f interface{}, args ...interface{}) error {
+	msg, cause := errorOf(f, args...)
+	return glogger().loge(ctx, 0, msg, cause, nil)
+}
+
+// FatalfCtx log with fatal level and ctx's request id, then handle by fatal policy
+func FatalfCtx(ctx context.Context, f interface{}, args ...interface{}) {
+	msg, cause := errorOf(f, args...)
+	glogger().fatal(ctx, 0, msg, cause, nil)
+}
+
+// DebugfDepth log with debug level, skip depth more caller frames
+func DebugfDepth(depth int, f interface{}, args ...interface{}) {
+	if l := glogger(); l.Enabled(LevelDebug) {
+		l.output(nil, 2+depth, LevelDebug, sprintf(f, args...), nil)
+	}
+}
+
+// InfofDepth log with info level, skip depth more caller frames
+func InfofDepth(depth int, f interface{}, args ...interface{}) {
+	if l := glogger(); l.Enabled(LevelInfo) {
+		l.output(nil, 2+depth, LevelInfo, sprintf(f, args...), nil)
+	}
+}
+
+// ErrorfDepth log with error level, skip depth more caller frames
+func ErrorfDepth(depth int, f interface{}, args ...interface{}) error {
+	msg, cause := errorOf(f, args...)
+	return glogger().loge(nil, depth, msg, cause, nil)
+}
+
+// FatalfDepth log with fatal level, skip depth more caller frames
+func FatalfDepth(depth int, f interface{}, args ...interface{}) {
+	msg, cause := errorOf(f, args...)
+	glogger().fatal(nil, depth, msg, cause, nil)
+}
+
+// SetLevel set global logger's min level
+func SetLevel(level Level) {
+	glogger().SetLevel(level)
+}
+
+// GetLevel returns global logger's min level
+func GetLevel() Level {
+	return glogger().GetLevel()
+}
+
+// LoggerFlush write pending lines of global logger
+func LoggerFlush() error {
+	return glogger().Flush()
+}
+
+// LoggerClose flush and close global logger in timeout
+func LoggerClose(timeout time.Duration) error {
+	return glogger().Close(timeout)
 }
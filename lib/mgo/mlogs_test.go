@@ -0,0 +1,201 @@
+package mgo
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetFormatConcurrent(t *testing.T) {
+	ring := NewRingSink(1000)
+	l := &Logger{level: int32(LevelDebug)}
+	l.AddSink(ring, LevelDebug, nil)
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			l.Infof("line %d", i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if i%2 == 0 {
+				l.SetFormat(JsonFormatter)
+			} else {
+				l.SetFormat(TextFormatter)
+			}
+		}
+	}()
+	wg.Wait()
+
+	l.SetFormat(JsonFormatter)
+	l.Infof("json")
+	lines := ring.Lines()
+	if last := lines[len(lines)-1]; !strings.HasPrefix(last, "{") {
+		t.Errorf("not json: %s", last)
+	}
+	l.SetFormat(nil)
+	l.Infof("text")
+	lines = ring.Lines()
+	if last := lines[len(lines)-1]; strings.HasPrefix(last, "{") {
+		t.Errorf("nil format not text: %s", last)
+	}
+}
+
+func TestInitGloggerAfterSetters(t *testing.T) {
+	old := loadGlogger()
+	glog.Store((*Logger)(nil))
+	glogOnce = sync.Once{}
+	defer func() {
+		glog.Store(old)
+		glogOnce = sync.Once{}
+	}()
+
+	// global setters before init use stdout logger
+	SetLevel(LevelInfo)
+	RedactKeys("password")
+	SetSampling(time.Hour, 100, 0)
+	ring := NewRingSink(10)
+	glogger().AddSink(ring, LevelDebug, nil)
+
+	pre := filepath.Join(t.TempDir(), "app")
+	InitLogger(pre)
+	l := glogger()
+	defer l.SetSampling(0, 0, 0)
+	Debugf("hidden")
+	Infow("login", "password", "hunter2")
+	LoggerFlush()
+
+	fnames := LogFiles(pre)
+	if len(fnames) != 1 {
+		t.Fatalf("log files %v", fnames)
+	}
+	b, _ := os.ReadFile(fnames[0])
+	out := string(b) + strings.Join(ring.Lines(), "\n")
+	if strings.Count(out, "login") != 2 || strings.Contains(out, "hunter2") || strings.Contains(out, "hidden") {
+		t.Errorf("settings not kept:\n%s", out)
+	}
+	if s := l.getSampler(); s == nil || s.logger != l {
+		t.Errorf("sampling not kept")
+	}
+	for _, s := range l.Sinks() {
+		if _, ok := s.(*WriterSink); ok {
+			t.Errorf("stdout sink kept")
+		}
+	}
+	l.Close(time.Second)
+}
+
+// discardLogger returns logger writing lines of format f to io.Discard
+func discardLogger(level Level, f Formatter) *Logger {
+	l := &Logger{level: int32(level)}
+	l.SetFormat(f)
+	l.AddSink(NewWriterSink(io.Discard), LevelDebug, nil)
+	return l
+}
+
+func BenchmarkDebugfDisabled(b *testing.B) {
+	l := discardLogger(LevelInfo, TextFormatter)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Debugf("request %d done", i)
+	}
+}
+
+func BenchmarkInfofConst(b *testing.B) {
+	l := discardLogger(LevelInfo, TextFormatter)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Infof("request done")
+	}
+}
+
+func BenchmarkInfofArgs(b *testing.B) {
+	l := discardLogger(LevelInfo, TextFormatter)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Infof("request %d done in %v", i, time.Millisecond)
+	}
+}
+
+func BenchmarkInfofNoCaller(b *testing.B) {
+	l := discardLogger(LevelInfo, TextFormatter).WithoutCaller()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Infof("request done")
+	}
+}
+
+func BenchmarkInfofCtx(b *testing.B) {
+	l := discardLogger(LevelInfo, TextFormatter)
+	ctx := WithRequestID(context.Background(), "5f3c2a1b-0001-0002-0003-000400050006")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.InfofCtx(ctx, "request done")
+	}
+}
+
+func BenchmarkInfofSetUuid(b *testing.B) {
+	l := discardLogger(LevelInfo, TextFormatter)
+	SetUuid("5f3c2a1b-0001-0002-0003-000400050006")
+	defer DelUuid()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Infof("request done")
+	}
+}
+
+func BenchmarkInfowText(b *testing.B) {
+	l := discardLogger(LevelInfo, TextFormatter).With("service", "api", "zone", 3)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Infow("request done", "path", "/api/v1", "code", 200)
+	}
+}
+
+func BenchmarkInfowJson(b *testing.B) {
+	l := discardLogger(LevelInfo, JsonFormatter)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Infow("request done", "path", "/api/v1", "code", 200)
+	}
+}
+
+func BenchmarkGoId(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		GoId()
+	}
+}
+
+func BenchmarkInfofFileAsync(b *testing.B) {
+	l := &Logger{level: int32(LevelInfo)}
+	l.AddSink(NewFileSink(false, filepath.Join(b.TempDir(), "bench"), 100*SIZE_1M), LevelDebug, nil)
+	defer l.Close(time.Second)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Infof("request done")
+	}
+}
+
+func BenchmarkInfofFileAsyncParallel(b *testing.B) {
+	l := &Logger{level: int32(LevelInfo)}
+	l.AddSink(NewFileSink(false, filepath.Join(b.TempDir(), "bench"), 100*SIZE_1M), LevelDebug, nil)
+	defer l.Close(time.Second)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			l.Infof("request done")
+		}
+	})
+}
@@ -85,6 +85,7 @@ func MSE(a ...float64) float64 {
 func LinearFit(sx []float64, sy []float64) (k float64, b float64) {
 	if len(sx) != len(sy) {
 		Fatalf("slice length not match x(%d) != y(%d)", len(sx), len(sy))
+		return 0, 0
 	}
 
 	num := float64(len(sx))
@@ -114,6 +115,7 @@ func LinearFit(sx []float64, sy []float64) (k float64, b float64) {
 func CmpFloats(a []float64, b []float64) int {
 	if len(a) != len(b) {
 		Fatalf("length not same %d != %d", len(a), len(b))
+		return 0
 	}
 
 	aa := 0
@@ -0,0 +1,278 @@
+package mgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Redacted is a secret string, it is always logged as REDACT_MASK
+type Redacted string
+
+func (self Redacted) String() string {
+	return REDACT_MASK
+}
+
+func (self Redacted) GoString() string {
+	return `"` + REDACT_MASK + `"`
+}
+
+func (self Redacted) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + REDACT_MASK + `"`), nil
+}
+
+func (self Redacted) LogValue() slog.Value {
+	return slog.StringValue(REDACT_MASK)
+}
+
+var (
+	// values of these field keys are masked, key is matched case-insensitive
+	// with '-' as '_', dotted key is also matched by its last part
+	defaultRedactKeys = []string{
+		"password", "passwd", "pwd", "secret", "client_secret", "token",
+		"access_token", "refresh_token", "api_key", "apikey", "authorization",
+		"cookie", "set_cookie", "private_key",
+	}
+
+	// only capture groups are masked
+	defaultRedactPatterns = []string{
+		`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`,
+		`(?i)\b(?:password|passwd|pwd|secret|client_secret|token|access_token|refresh_token|` +
+			`api_key|apikey)["']?\s*[:=]\s*["']?([^\s"'&,;}]+)`,
+	}
+)
+
+// redactor is immutable redaction rules of a logger, replaced on change
+type redactor struct {
+	keys     map[string]bool
+	patterns []*regexp.Regexp
+}
+
+func redactKey(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "-", "_")
+}
+
+func (self *redactor) isKey(key string) bool {
+	key = redactKey(key)
+	if self.keys[key] {
+		return true
+	}
+	if i := strings.LastIndexByte(key, '.'); i >= 0 {
+		return self.keys[key[i+1:]]
+	}
+	return false
+}
+
+// redactString mask matches of patterns, or their groups if pattern has groups
+func (self *redactor) redactString(s string) string {
+	for _, re := range self.patterns {
+		if !re.MatchString(s) {
+			continue
+		}
+		b := []byte{}
+		last := 0
+		for _, m := range re.FindAllStringSubmatchIndex(s, -1) {
+			spans := m[:2]
+			if len(m) > 2 {
+				spans = m[2:]
+			}
+			for i := 0; i < len(spans); i += 2 {
+				if spans[i] < last {
+					continue
+				}
+				b = append(b, s[last:spans[i]]...)
+				b = append(b, REDACT_MASK...)
+				last = spans[i+1]
+			}
+		}
+		s = string(append(b, s[last:]...))
+	}
+	return s
+}
+
+// redactValue returns masked value and true if value is changed
+func (self *redactor) redactValue(key string, v interface{}) (interface{}, bool) {
+	if self.isKey(key) {
+		return REDACT_MASK, true
+	}
+
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		return self.redactComposite(v)
+	}
+	if r := self.redactString(s); r != s {
+		return r, true
+	}
+	return v, false
+}
+
+// redactComposite redact map, slice, array or struct value, e.g. http.Header
+// or request body, by walking its json form, changed value is returned as
+// json-decoded tree of map[string]interface{}, []interface{} and scalars
+func (self *redactor) redactComposite(v interface{}) (interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+	default:
+		return v, false
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v, false
+	}
+	var tree interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	if d.Decode(&tree) != nil {
+		return v, false
+	}
+	if tree, ok := self.redactTree(tree); ok {
+		return tree, true
+	}
+	return v, false
+}
+
+// redactTree mask values of keys and patterns in json-decoded tree in place
+func (self *redactor) redactTree(v interface{}) (interface{}, bool) {
+	changed := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, x := range v {
+			if self.isKey(k) {
+				v[k], changed = REDACT_MASK, true
+			} else if x, ok := self.redactTree(x); ok {
+				v[k], changed = x, true
+			}
+		}
+	case []interface{}:
+		for i, x := range v {
+			if x, ok := self.redactTree(x); ok {
+				v[i], changed = x, true
+			}
+		}
+	case string:
+		if r := self.redactString(v); r != v {
+			return r, true
+		}
+	}
+	return v, changed
+}
+
+// redact mask msg and field values of e, e.Fields is copied before change
+func (self *redactor) redact(e *Entry) {
+	e.Msg = self.redactString(e.Msg)
+	copied := false
+	for i, f := range e.Fields {
+		v, ok := self.redactValue(f.Key, f.Value)
+		if !ok {
+			continue
+		}
+		if !copied {
+			e.Fields = append([]Field{}, e.Fields...)
+			copied = true
+		}
+		e.Fields[i].Value = v
+	}
+}
+
+func (self *Logger) getRedactor() *redactor {
+	r, _ := self.redactor.Load().(*redactor)
+	return r
+}
+
+// updateRedactor copy rules, change them by fn and replace old rules
+func (self *Logger) updateRedactor(fn func(r *redactor)) {
+	self.rmutex.Lock()
+	defer self.rmutex.Unlock()
+
+	r := &redactor{keys: map[string]bool{}}
+	if old := self.getRedactor(); old != nil {
+		for k := range old.keys {
+			r.keys[k] = true
+		}
+		r.patterns = append(r.patterns, old.patterns...)
+	}
+	fn(r)
+	self.redactor.Store(r)
+}
+
+// RedactKeys mask values of fields with keys, rules apply to child loggers
+func (self *Logger) RedactKeys(keys ...string) {
+	self.updateRedactor(func(r *redactor) {
+		for _, key := range keys {
+			r.keys[redactKey(key)] = true
+		}
+	})
+}
+
+// RedactPattern mask matches of expr in msg and field values
+// if expr has capture groups, only groups are masked, e.g. `token=(\w+)`
+func (self *Logger) RedactPattern(expr string) error {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	self.updateRedactor(func(r *redactor) {
+		r.patterns = append(r.patterns, re)
+	})
+	return nil
+}
+
+// RedactDefaults add default rules for passwords, tokens, secrets and bearer auth
+func (self *Logger) RedactDefaults() {
+	self.RedactKeys(defaultRedactKeys...)
+	for _, expr := range defaultRedactPatterns {
+		self.RedactPattern(expr)
+	}
+}
+
+// redactEntry apply rules of logger and its parents to e
+func (self *Logger) redactEntry(e *Entry) {
+	for l := self; l != nil; l = l.up() {
+		if r := l.getRedactor(); r != nil {
+			r.redact(e)
+		}
+	}
+}
+
+// redactLine apply patterns of logger and its parents to raw line
+func (self *Logger) redactLine(s string) string {
+	for l := self; l != nil; l = l.up() {
+		if r := l.getRedactor(); r != nil {
+			s = r.redactString(s)
+		}
+	}
+	return s
+}
+
+// RedactKeys mask values of fields with keys in global logger
+func RedactKeys(keys ...string) {
+	glogger().RedactKeys(keys...)
+}
+
+// RedactPattern mask matches of expr in global logger
+func RedactPattern(expr string) error {
+	return glogger().RedactPattern(expr)
+}
+
+// RedactDefaults add default redaction rules to global logger
+func RedactDefaults() {
+	glogger().RedactDefaults()
+}
@@ -3,6 +3,7 @@ package mgo
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"sync"
@@ -28,115 +29,181 @@ import (
 // **useful mux/handler**
 //   NewServeMux() // create mux replace DefaultServeMux
 //   FileServer, NotFoundHandler, RedirectHandler
+// **runtime log control and profile**
+//   http.Handle("/debug/mgo/", AdminHandler("/debug/mgo"))
+// **request id**
+//   route is wrapped by RequestIDHandler, see it
 func HttpServe(addr string, route func(w http.ResponseWriter, r *http.Request)) error {
-	http.HandleFunc("/", route)
+	http.HandleFunc("/", RequestIDHandler(route))
 	return http.ListenAndServe(addr, nil)
 }
 
-// HttpPost post request to url
-func HttpPost(url string, reqs, resp interface{}, timeout int) error {
-	body, err := json.Marshal(reqs)
-	if err != nil {
-		return err
-	}
-	client := http.Client{
-		Timeout: time.Duration(timeout) * time.Second,
-	}
-	raw, err := client.Post(url, "application/json", bytes.NewBuffer(body))
-	if err != nil {
-		return err
-	}
-	defer raw.Body.Close()
+// RequestIDHandler wrap route to accept request id from header
+// REQUEST_ID_HEADER, or generate one by Uuid if missing or invalid
+// the id is set as uuid of route's goroutine, carried by r.Context()
+// and returned in response header, so logs of all services share it
+// uuid-cache is not empty while serving, so Infof looks up GoId for every line,
+// log by r.Context() with InfofCtx and friends to skip it
+func RequestIDHandler(route func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(REQUEST_ID_HEADER)
+		if !validRequestID(id) {
+			id = Uuid()
+		}
+		SetUuid(id)
+		defer DelUuid()
 
-	body, err = ioutil.ReadAll(raw.Body)
-	if err != nil {
-		return err
+		w.Header().Set(REQUEST_ID_HEADER, id)
+		route(w, r.WithContext(WithRequestID(r.Context(), id)))
 	}
+}
 
-	if len(body) != 0 && resp != nil {
-		err = json.Unmarshal(body, resp)
-		if err != nil {
-			return err
+// validRequestID check id is short and safe to log, [0-9A-Za-z-_.:]{1,128}
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		ok := c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			c == '-' || c == '_' || c == '.' || c == ':'
+		if !ok {
+			return false
 		}
 	}
+	return true
+}
 
-	return nil
+// HttpPost post request to url, uuid of current goroutine is sent as
+// header REQUEST_ID_HEADER
+func HttpPost(url string, reqs, resp interface{}, timeout int) error {
+	_, err := httpDo("POST", url, reqs, resp, time.Duration(timeout)*time.Second)
+	return err
 }
 
-// HttpDelete run delete method to url
+// HttpDelete run delete method to url, uuid is sent as HttpPost
 func HttpDelete(url string, resp interface{}, timeout int) error {
-	client := &http.Client{
-		Timeout: time.Duration(timeout) * time.Second,
+	_, err := httpDo("DELETE", url, nil, resp, time.Duration(timeout)*time.Second)
+	return err
+}
+
+// httpDo send reqs as json body if not nil, unmarshal response body to resp
+// returns response status code, non-2xx status is not error
+func httpDo(method, url string, reqs, resp interface{}, timeout time.Duration) (int, error) {
+	var reader io.Reader
+	if reqs != nil {
+		body, err := json.Marshal(reqs)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(body)
 	}
-	request, err := http.NewRequest("DELETE", url, nil)
+	request, err := http.NewRequest(method, url, reader)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if reqs != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if uuid := GetUuid(); uuid != "" {
+		request.Header.Set(REQUEST_ID_HEADER, uuid)
 	}
 
+	client := &http.Client{
+		Timeout: timeout,
+	}
 	raw, err := client.Do(request)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer raw.Body.Close()
 
 	body, err := ioutil.ReadAll(raw.Body)
 	if err != nil {
-		return err
+		return raw.StatusCode, err
 	}
 
 	if len(body) != 0 && resp != nil {
 		err = json.Unmarshal(body, resp)
 		if err != nil {
-			return err
+			return raw.StatusCode, err
 		}
 	}
 
-	return nil
+	return raw.StatusCode, nil
 }
 
 // RateLimiter can be used to limit request rate
 type RateLimiter struct {
-	ticker *time.Ticker  // const duration ticker
+	ticker *time.Ticker  // const duration ticker, nil if refilled by caller
 	yield  int64         // const yield balls each duration
 	limit  int64         // const bucket size
 	balls  int64         // atomic current available balls
 	lock   sync.Mutex    // lock allow function include check+set two step
 	ch     chan struct{} // channel used to wait balls
+	done   chan struct{} // closed by Stop
 }
 
 // NewRateLimiter create a rate-limiter
+// dur <= 0 means no ticker, balls are added by calling Refill
 func NewRateLimiter(dur time.Duration, yield, limit int64) *RateLimiter {
 	r := &RateLimiter{
-		ticker: time.NewTicker(dur),
-		yield:  yield,
-		limit:  limit,
-		balls:  0,
-		ch:     make(chan struct{}),
-		lock:   sync.Mutex{},
-	}
-	go r.run()
+		yield: yield,
+		limit: limit,
+		balls: 0,
+		ch:    make(chan struct{}),
+		done:  make(chan struct{}),
+		lock:  sync.Mutex{},
+	}
+	if dur > 0 {
+		r.ticker = time.NewTicker(dur)
+		go r.run()
+	}
 	return r
 }
 
 func (self *RateLimiter) run() {
-	for range self.ticker.C {
-		if atomic.LoadInt64(&self.balls)+self.yield < self.limit {
-			atomic.AddInt64(&self.balls, self.yield)
-		} else {
-			atomic.StoreInt64(&self.balls, self.limit)
+	for {
+		select {
+		case <-self.ticker.C:
+		case <-self.done:
+			return
 		}
+		self.Refill()
+	}
+}
 
-		for atomic.LoadInt64(&self.balls) > 0 {
-			select {
-			case <-self.ch:
-				atomic.AddInt64(&self.balls, -1)
-			default:
-				break
-			}
+// Refill add yield balls up to limit and wake waiting callers, called each tick
+func (self *RateLimiter) Refill() {
+	if atomic.LoadInt64(&self.balls)+self.yield < self.limit {
+		atomic.AddInt64(&self.balls, self.yield)
+	} else {
+		atomic.StoreInt64(&self.balls, self.limit)
+	}
+
+wake:
+	for atomic.LoadInt64(&self.balls) > 0 {
+		select {
+		case <-self.ch:
+			atomic.AddInt64(&self.balls, -1)
+		default:
+			break wake
 		}
 	}
 }
 
+// Fill fill bucket to limit, new limiter has no balls until first tick
+func (self *RateLimiter) Fill() {
+	atomic.StoreInt64(&self.balls, self.limit)
+}
+
+// Stop stop refilling balls, waiting callers are not woken, call it once
+func (self *RateLimiter) Stop() {
+	if self.ticker != nil {
+		self.ticker.Stop()
+	}
+	close(self.done)
+}
+
 // Allow return if has balls
 func (self *RateLimiter) Allow() bool {
 	self.lock.Lock()
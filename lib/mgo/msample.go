@@ -0,0 +1,164 @@
+package mgo
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sampler limits lines of each call site: first lines per interval
+// are logged, then 1 in thereafter lines, suppressed counts are reported
+// each interval as a line of the call site
+// limiters of call sites have no ticker, they are refilled by report so that
+// all windows follow the sampler's ticker
+type sampler struct {
+	logger     *Logger // owner, summary lines are written through it
+	interval   time.Duration
+	first      int64
+	thereafter int64 // 0 means drop all lines over first
+
+	sites  atomic.Value // map[uintptr]*site, copied on write
+	smutex sync.Mutex   // lock: sites update
+	ticker *time.Ticker
+	done   chan struct{}
+}
+
+// site is sampling state of a call site
+type site struct {
+	limiter    *RateLimiter // refilled by sampler's report
+	caller     *caller
+	level      int32 // atomic level of last line
+	over       int64 // atomic lines over first in current interval
+	suppressed int64 // atomic suppressed lines in current interval
+}
+
+func newSampler(l *Logger, interval time.Duration, first, thereafter int64) *sampler {
+	s := &sampler{
+		logger:     l,
+		interval:   interval,
+		first:      first,
+		thereafter: thereafter,
+		ticker:     time.NewTicker(interval),
+		done:       make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (self *sampler) run() {
+	for {
+		select {
+		case <-self.ticker.C:
+			self.report()
+		case <-self.done:
+			self.report()
+			return
+		}
+	}
+}
+
+func (self *sampler) stop() {
+	self.ticker.Stop()
+	close(self.done)
+}
+
+func (self *sampler) getSites() map[uintptr]*site {
+	m, _ := self.sites.Load().(map[uintptr]*site)
+	return m
+}
+
+// getSite returns state of call site pc, create it if not exist
+func (self *sampler) getSite(pc uintptr, c *caller) *site {
+	if st, ok := self.getSites()[pc]; ok {
+		return st
+	}
+
+	self.smutex.Lock()
+	defer self.smutex.Unlock()
+	m := self.getSites()
+	if st, ok := m[pc]; ok {
+		return st
+	}
+	st := &site{
+		limiter: NewRateLimiter(0, self.first, self.first),
+		caller:  c,
+	}
+	st.limiter.Fill()
+	n := make(map[uintptr]*site, len(m)+1)
+	for k, v := range m {
+		n[k] = v
+	}
+	n[pc] = st
+	self.sites.Store(n)
+	return st
+}
+
+// allow check if line of call site pc should be logged
+func (self *sampler) allow(pc uintptr, c *caller, level Level) bool {
+	st := self.getSite(pc, c)
+	atomic.StoreInt32(&st.level, int32(level))
+	if st.limiter.Allow() {
+		return true
+	}
+	over := atomic.AddInt64(&st.over, 1)
+	if self.thereafter > 0 && over%self.thereafter == 0 {
+		return true
+	}
+	atomic.AddInt64(&st.suppressed, 1)
+	return false
+}
+
+// report write suppressed counts of call sites since last report, and start
+// new interval of call sites
+func (self *sampler) report() {
+	for pc, st := range self.getSites() {
+		st.limiter.Refill()
+		atomic.StoreInt64(&st.over, 0)
+		num := atomic.SwapInt64(&st.suppressed, 0)
+		if num == 0 {
+			continue
+		}
+		self.logger.write(&Entry{
+			Time:  time.Now(),
+			Level: Level(atomic.LoadInt32(&st.level)),
+			PC:    pc,
+			File:  st.caller.file,
+			Func:  st.caller.fn,
+			Line:  st.caller.line,
+			Msg:   fmt.Sprintf("sampling suppressed %d lines in %v", num, self.interval),
+		})
+	}
+}
+
+// getSampler returns sampler of logger or its nearest parent
+func (self *Logger) getSampler() *sampler {
+	for l := self; l != nil; l = l.up() {
+		if s, _ := l.sampler.Load().(*sampler); s != nil {
+			if s.interval <= 0 {
+				return nil
+			}
+			return s
+		}
+	}
+	return nil
+}
+
+// SetSampling limit lines of each call site: first lines per interval are
+// logged, then 1 in thereafter lines, 0 thereafter drops all the others
+// suppressed counts are logged each interval, fatal lines are never sampled
+// interval <= 0 disables sampling, child loggers inherit sampling
+func (self *Logger) SetSampling(interval time.Duration, first, thereafter int64) {
+	s := &sampler{}
+	if interval > 0 {
+		s = newSampler(self, interval, first, thereafter)
+	}
+	if old, _ := self.sampler.Swap(s).(*sampler); old != nil && old.interval > 0 {
+		old.stop()
+	}
+}
+
+// SetSampling set sampling of global logger
+func SetSampling(interval time.Duration, first, thereafter int64) {
+	glogger().SetSampling(interval, first, thereafter)
+}
@@ -0,0 +1,39 @@
+package mgo
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSampling(t *testing.T) {
+	logs := NewCaptureSink()
+	l := &Logger{level: int32(LevelDebug)}
+	l.AddSink(logs, LevelDebug, nil)
+	l.SetSampling(time.Hour, 3, 5)
+	defer l.SetSampling(0, 0, 0)
+
+	goroutines := runtime.NumGoroutine()
+	for window := 0; window < 2; window++ {
+		logs.Reset()
+		for i := 0; i < 20; i++ {
+			l.Errorf("downstream failed")
+		}
+		// first 3, then over counts 5, 10 and 15
+		logs.AssertCount(t, 6, LevelError, "downstream failed")
+
+		l.getSampler().report() // as if interval ended
+		logs.AssertCount(t, 1, LevelError, "sampling suppressed 14 lines")
+	}
+
+	logs.Reset()
+	for i := 0; i < 10; i++ {
+		l.Infof("site %d", i) // one call site, first 3 and over count 5
+		l.Debugf("other site %d", i)
+	}
+	logs.AssertCount(t, 4, LevelInfo, "site")
+	logs.AssertCount(t, 4, LevelDebug, "other site")
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("call sites started %d goroutines", n-goroutines)
+	}
+}
@@ -0,0 +1,336 @@
+package mgo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// HttpSinkConf is http sink config, zero fields use defaults
+type HttpSinkConf struct {
+	Url        string        // collector url, batches are POSTed as json array
+	Spill      string        // file keeping lines when collector is unreachable
+	BatchLines int           // max lines per batch, default 100
+	BatchBytes int           // max bytes per batch, default 1M
+	Interval   time.Duration // ship pending lines at least every interval, default 1s
+	Timeout    time.Duration // request timeout, default 10s
+	Retries    int           // retries of failed batch before spilling, default 3
+	Backoff    time.Duration // wait before first retry, doubled each retry, default 100ms
+	MaxPending int           // pending bytes over it are spilled by writer, default 16*BatchBytes
+}
+
+// HttpSink ship lines to collector in batches, json lines are sent as
+// objects, other lines as strings, failed batches are spilled to file and
+// replayed in order after collector is back
+type HttpSink struct {
+	conf     HttpSinkConf
+	pending  [][]byte // lines waiting to ship
+	size     int      // bytes of pending
+	mutex    sync.Mutex
+	fmutex   sync.Mutex // lock: spill file
+	lastFail time.Time  // time of last failed batch, used by run goroutine
+
+	kick    chan bool          // wake run goroutine when batch is full
+	flush   chan chan struct{} // ship pending and reply
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewHttpSink create http sink and start ship goroutine
+func NewHttpSink(conf HttpSinkConf) *HttpSink {
+	if conf.BatchLines <= 0 {
+		conf.BatchLines = 100
+	}
+	if conf.BatchBytes <= 0 {
+		conf.BatchBytes = SIZE_1M
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = time.Second
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10 * time.Second
+	}
+	if conf.Retries < 0 {
+		conf.Retries = 0
+	} else if conf.Retries == 0 {
+		conf.Retries = 3
+	}
+	if conf.Backoff <= 0 {
+		conf.Backoff = 100 * time.Millisecond
+	}
+	if conf.MaxPending <= 0 {
+		conf.MaxPending = 16 * conf.BatchBytes
+	}
+
+	s := &HttpSink{
+		conf:    conf,
+		kick:    make(chan bool, 1),
+		flush:   make(chan chan struct{}),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (self *HttpSink) run() {
+	defer close(self.stopped)
+	ticker := time.NewTicker(self.conf.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-self.kick:
+		case reply := <-self.flush:
+			self.ship()
+			close(reply)
+			continue
+		case <-self.done:
+			self.ship()
+			return
+		}
+		self.ship()
+	}
+}
+
+// Write add lines to pending, pending over MaxPending is spilled
+// lines written after Close are spilled
+func (self *HttpSink) Write(b []byte) error {
+	lines := bytes.Split(bytes.TrimRight(b, "\n"), []byte("\n"))
+	select {
+	case <-self.stopped:
+		return self.spill(lines)
+	default:
+	}
+
+	self.mutex.Lock()
+	for _, line := range lines {
+		self.pending = append(self.pending, append([]byte{}, line...))
+		self.size += len(line)
+	}
+	full := len(self.pending) >= self.conf.BatchLines || self.size >= self.conf.BatchBytes
+	var over [][]byte
+	if self.size > self.conf.MaxPending {
+		over = self.pending
+		self.pending, self.size = nil, 0
+	}
+	self.mutex.Unlock()
+
+	if over != nil {
+		return self.spill(over)
+	}
+	if full {
+		select {
+		case self.kick <- true:
+		default:
+		}
+	}
+	return nil
+}
+
+// Flush ship pending lines, failed lines are spilled
+func (self *HttpSink) Flush() error {
+	reply := make(chan struct{})
+	select {
+	case self.flush <- reply:
+		<-reply
+	case <-self.stopped:
+	}
+	return nil
+}
+
+// Close ship pending lines and stop ship goroutine
+func (self *HttpSink) Close() error {
+	select {
+	case <-self.done:
+	default:
+		close(self.done)
+	}
+	<-self.stopped
+	return nil
+}
+
+// batch take lines of one batch from pending
+func (self *HttpSink) batch() [][]byte {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	n, size := 0, 0
+	for n < len(self.pending) && n < self.conf.BatchLines {
+		if n > 0 && size+len(self.pending[n]) > self.conf.BatchBytes {
+			break
+		}
+		size += len(self.pending[n])
+		n++
+	}
+	lines := self.pending[:n:n]
+	self.pending = self.pending[n:]
+	self.size -= size
+	return lines
+}
+
+// drain take all pending lines
+func (self *HttpSink) drain() [][]byte {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	lines := self.pending
+	self.pending, self.size = nil, 0
+	return lines
+}
+
+// spilled check if there are spilled lines to replay
+func (self *HttpSink) spilled() bool {
+	return self.conf.Spill != "" && (PathExist(self.conf.Spill) || PathExist(self.conf.Spill+".replay"))
+}
+
+// ship send pending batches, failed batch and the rest are spilled
+// while there are spilled lines, pending lines are spilled after them to keep
+// order, and replay is tried after 10 intervals since last failure
+func (self *HttpSink) ship() {
+	if self.spilled() {
+		self.spill(self.drain())
+		if time.Since(self.lastFail) > 10*self.conf.Interval {
+			self.replay()
+		}
+		return
+	}
+
+	for {
+		lines := self.batch()
+		if len(lines) == 0 {
+			return
+		}
+		if err := self.send(lines, self.conf.Retries); err != nil {
+			self.lastFail = time.Now()
+			self.spill(append(lines, self.drain()...))
+			return
+		}
+	}
+}
+
+// send post lines with retries, waiting backoff doubled before each retry
+func (self *HttpSink) send(lines [][]byte, retries int) error {
+	reqs := make([]json.RawMessage, 0, len(lines))
+	for _, line := range lines {
+		if !json.Valid(line) {
+			line, _ = json.Marshal(string(line))
+		}
+		reqs = append(reqs, line)
+	}
+
+	var err error
+	backoff := self.conf.Backoff
+	for i := 0; ; i++ {
+		var code int
+		code, err = httpDo("POST", self.conf.Url, reqs, nil, self.conf.Timeout)
+		if err == nil && (code < 200 || code >= 300) {
+			err = fmt.Errorf("http status %d", code)
+		}
+		if err == nil || i >= retries {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-self.done:
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// spill append lines to spill file, lines are dropped if no spill file
+func (self *HttpSink) spill(lines [][]byte) error {
+	if self.conf.Spill == "" || len(lines) == 0 {
+		return nil
+	}
+	self.fmutex.Lock()
+	defer self.fmutex.Unlock()
+
+	f, err := os.OpenFile(self.conf.Spill, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	buf := []byte{}
+	for _, line := range lines {
+		buf = append(append(buf, line...), '\n')
+	}
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// replay send spilled lines in order, spill file is renamed to .replay
+// while sending, so lines spilled meanwhile go after it
+// replay file is kept on read error, its lines may be sent again later
+func (self *HttpSink) replay() {
+	rfile := self.conf.Spill + ".replay"
+	self.fmutex.Lock()
+	if !PathExist(rfile) {
+		if err := os.Rename(self.conf.Spill, rfile); err != nil {
+			self.fmutex.Unlock()
+			return
+		}
+	}
+	self.fmutex.Unlock()
+
+	f, err := os.Open(rfile)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	lio := NewLio(f)
+	lines, size, sent := [][]byte{}, 0, 0
+	for more := lio.Read(); more || len(lines) > 0; {
+		if more {
+			line := []byte(lio.Line())
+			lines = append(lines, line)
+			size += len(line)
+			more = lio.Read()
+			if more && len(lines) < self.conf.BatchLines && size < self.conf.BatchBytes {
+				continue
+			}
+		}
+		if err := self.send(lines, 0); err != nil {
+			self.lastFail = time.Now()
+			if sent > 0 {
+				if more {
+					lines = append(lines, []byte(lio.Line()))
+				}
+				self.rewrite(rfile, lines, lio)
+			}
+			return
+		}
+		sent += len(lines)
+		lines, size = lines[:0], 0
+	}
+	if lio.Err() != nil {
+		return
+	}
+	os.Remove(rfile)
+}
+
+// rewrite replace rfile by unsent lines and the rest lines of lio
+// rfile is kept as is on read error
+func (self *HttpSink) rewrite(rfile string, lines [][]byte, lio *Lio) {
+	buf := []byte{}
+	for _, line := range lines {
+		buf = append(append(buf, line...), '\n')
+	}
+	for lio.Read() {
+		buf = append(append(buf, lio.Line()...), '\n')
+	}
+	if lio.Err() != nil {
+		return
+	}
+	tmp := rfile + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0644); err == nil {
+		os.Rename(tmp, rfile)
+	}
+}
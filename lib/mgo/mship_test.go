@@ -0,0 +1,155 @@
+package mgo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector is test http server receiving HttpSink batches
+type collector struct {
+	srv     *httptest.Server
+	fails   int // next requests answered by 500, -1 for all
+	batches [][]string
+	mutex   sync.Mutex
+}
+
+func newCollector(t *testing.T) *collector {
+	c := &collector{}
+	c.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		if c.fails != 0 {
+			if c.fails > 0 {
+				c.fails--
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		raws := []json.RawMessage{}
+		if err := json.NewDecoder(r.Body).Decode(&raws); err != nil {
+			t.Errorf("decode batch: %v", err)
+		}
+		batch := []string{}
+		for _, raw := range raws {
+			s := ""
+			if json.Unmarshal(raw, &s) != nil {
+				s = string(raw)
+			}
+			batch = append(batch, s)
+		}
+		c.batches = append(c.batches, batch)
+	}))
+	t.Cleanup(c.srv.Close)
+	return c
+}
+
+func (self *collector) setFails(n int) {
+	self.mutex.Lock()
+	self.fails = n
+	self.mutex.Unlock()
+}
+
+func (self *collector) lines() []string {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	lines := []string{}
+	for _, b := range self.batches {
+		lines = append(lines, b...)
+	}
+	return lines
+}
+
+func writeLines(t *testing.T, s *HttpSink, lines ...string) {
+	for _, line := range lines {
+		if err := s.Write([]byte(line + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHttpSinkBatch(t *testing.T) {
+	c := newCollector(t)
+	s := NewHttpSink(HttpSinkConf{Url: c.srv.URL, BatchLines: 3, Interval: time.Hour})
+	defer s.Close()
+
+	writeLines(t, s, "l1", `{"msg":"l2"}`, "l3", "l4", "l5", "l6", "l7")
+	s.Flush()
+
+	if got := strings.Join(c.lines(), ","); got != `l1,{"msg":"l2"},l3,l4,l5,l6,l7` {
+		t.Errorf("lines %q", got)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.batches) < 3 {
+		t.Errorf("%d batches", len(c.batches))
+	}
+	for i, b := range c.batches {
+		if len(b) > 3 {
+			t.Errorf("batch %d has %d lines", i, len(b))
+		}
+	}
+}
+
+func TestHttpSinkRetry(t *testing.T) {
+	c := newCollector(t)
+	c.setFails(2)
+	spill := filepath.Join(t.TempDir(), "spill")
+	s := NewHttpSink(HttpSinkConf{Url: c.srv.URL, Spill: spill, Interval: time.Hour,
+		Retries: 2, Backoff: time.Millisecond})
+	defer s.Close()
+
+	writeLines(t, s, "l1", "l2")
+	s.Flush()
+	if got := strings.Join(c.lines(), ","); got != "l1,l2" {
+		t.Errorf("lines %q", got)
+	}
+	if PathExist(spill) {
+		t.Errorf("retried batch spilled")
+	}
+}
+
+func TestHttpSinkSpillReplay(t *testing.T) {
+	c := newCollector(t)
+	c.setFails(-1)
+	spill := filepath.Join(t.TempDir(), "spill")
+	s := NewHttpSink(HttpSinkConf{Url: c.srv.URL, Spill: spill, Interval: 10 * time.Millisecond,
+		Retries: 1, Backoff: time.Millisecond})
+	defer s.Close()
+
+	long := strings.Repeat("x", 200*SIZE_1K) // over old 128K line limit
+	writeLines(t, s, "l1", "l2")
+	s.Flush()
+	writeLines(t, s, long, "l3")
+	s.Flush()
+	if !PathExist(spill) || len(c.lines()) != 0 {
+		t.Fatalf("lines not spilled")
+	}
+
+	c.setFails(0)
+	writeLines(t, s, "l4")
+	deadline := time.Now().Add(5 * time.Second)
+	for len(c.lines()) < 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Flush()
+
+	want := []string{"l1", "l2", long, "l3", "l4"}
+	got := c.lines()
+	if len(got) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d out of order, len %d", i, len(got[i]))
+		}
+	}
+	if PathExist(spill) || PathExist(spill+".replay") {
+		t.Errorf("spill files left")
+	}
+}
@@ -0,0 +1,696 @@
+package mgo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// interval to report dropped lines into log
+const dropReportInterval = 10 * time.Second
+
+// Sink is log output, Write receives whole lines and must not retain b
+// Flush writes pending lines, Close flushes and releases resources
+type Sink interface {
+	Write(b []byte) error
+	Flush() error
+	Close() error
+}
+
+// Rotate decides when file sink switch to a new file
+type Rotate int
+
+const (
+	RotateSize Rotate = iota // switch file only when max size exceeded
+	RotateHour               // also switch file on hour boundary
+	RotateDay                // also switch file on day boundary
+)
+
+// FilePolicy is file sink rotation and retention policy
+type FilePolicy struct {
+	Rotate   Rotate
+	MaxAge   time.Duration // remove rotated files older than MaxAge, 0 means keep
+	MaxCount int           // keep at most MaxCount rotated files, 0 means keep
+	Compress bool          // gzip rotated files into <name>.gz
+	Symlink  bool          // keep <pre>.log pointing at active file
+}
+
+// EntrySink is a sink which receives entries instead of formatted lines
+// WriteEntry must not retain e, Write receives raw lines from Logger.Write
+type EntrySink interface {
+	Sink
+	WriteEntry(e *Entry) error
+}
+
+// FullPolicy decides what async file sink does when buf is full
+type FullPolicy int
+
+const (
+	FullBlock      FullPolicy = iota // block writer until buf is flushed
+	FullDropNewest                   // drop lines being written
+	FullDropOldest                   // drop oldest lines in buf
+)
+
+// FileSink write lines to file <pre>-YYYYMMDDHH
+// mutex deadlock with dirty
+type FileSink struct {
+	pre  string // log filename prefix
+	max  int64  // log file max size
+	sync bool   // log sync mode
+
+	policy FilePolicy
+	fname  string             // active file name
+	period string             // active file rotate period
+	fio    io.ReadWriteCloser // log file handler
+	num    int64              // log file size, num=-1 indicate fio not open
+	fmutex sync.Mutex         // lock: policy, fname, period, fio, num
+	amutex sync.Mutex         // lock: archive
+
+	buf    []byte     // log buf
+	limit  int        // async buf max bytes, 0 means unlimited
+	full   FullPolicy // what to do when buf is full
+	closed bool       // sink is closed
+	mutex  sync.Mutex // lock: buf, limit, full, closed
+	cond   *sync.Cond // wait buf flushed, FullBlock only
+
+	dropLines    int64        // atomic dropped lines
+	dropBytes    int64        // atomic dropped bytes
+	droppedLines int64        // dropped lines already reported
+	format       atomic.Value // Formatter of drop report, logger's format
+
+	dirty   chan bool     // log buf is dirty
+	done    chan struct{} // stop flush goroutine
+	stopped chan struct{} // flush goroutine exited
+}
+
+// NewFileSink create file sink, async sink starts a flush goroutine
+func NewFileSink(syncMode bool, pre string, size int64) *FileSink {
+	s := &FileSink{
+		sync:    syncMode,
+		pre:     pre,
+		max:     size,
+		num:     -1,
+		dirty:   make(chan bool, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mutex)
+
+	if !syncMode {
+		go s.flush()
+	}
+
+	return s
+}
+
+func (self *FileSink) close() {
+	if self.fio != nil {
+		self.fio.Close()
+	}
+	self.fio = nil
+	self.num = -1
+}
+
+// SetPolicy set rotation and retention policy
+func (self *FileSink) SetPolicy(p FilePolicy) {
+	self.fmutex.Lock()
+	defer self.fmutex.Unlock()
+	self.policy = p
+}
+
+// FileName returns active file name
+func (self *FileSink) FileName() string {
+	self.fmutex.Lock()
+	defer self.fmutex.Unlock()
+	return self.fname
+}
+
+func (self *FileSink) periodOf(t time.Time) string {
+	if self.policy.Rotate == RotateDay {
+		return t.Format("20060102") + "00"
+	}
+	return t.Format("2006010215")
+}
+
+func (self *FileSink) open() error {
+	now := time.Now()
+	period := self.periodOf(now)
+	expired := self.period != period && (self.fio == nil || self.policy.Rotate != RotateSize)
+	if self.fio != nil && self.num >= 0 && self.num < self.max && !expired {
+		return nil
+	}
+	self.close()
+
+	usable := func(fname string) bool {
+		return !PathExist(fname+".gz") && FileSize(fname) < self.max
+	}
+	fname := self.fname
+	if fname == "" || expired || !usable(fname) {
+		fname = fmt.Sprintf("%s-%s", self.pre, period)
+		for _, layout := range []string{"2006010215.0405", "2006010215.0405.000", "2006010215.0405.000000"} {
+			if usable(fname) {
+				break
+			}
+			fname = fmt.Sprintf("%s-%s", self.pre, now.Format(layout))
+		}
+	}
+	err := CreateFile(fname)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	self.fio = f
+	self.num = FileSize(fname)
+	self.period = period
+
+	if fname != self.fname {
+		if self.policy.Symlink {
+			self.symlink(fname)
+		}
+		if self.fname != "" {
+			go self.archive(fname, self.policy)
+		}
+		self.fname = fname
+	}
+	return nil
+}
+
+// symlink point <pre>.log to active file
+func (self *FileSink) symlink(fname string) {
+	link := self.pre + ".log"
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(path.Base(fname), tmp); err != nil {
+		return
+	}
+	os.Rename(tmp, link)
+}
+
+// logFileInfos returns files of pre sorted by modify time, oldest first
+func logFileInfos(pre string) []os.FileInfo {
+	names, _ := filepath.Glob(pre + "-*")
+	files := []os.FileInfo{}
+	for _, name := range names {
+		stamp := strings.TrimPrefix(name, pre+"-")
+		if stamp == "" || stamp[0] < '0' || stamp[0] > '9' || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		if fi, err := os.Stat(name); err == nil && fi.Mode().IsRegular() {
+			files = append(files, fi)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	return files
+}
+
+// LogFiles returns files <pre>-YYYYMMDDHH* including gzipped, oldest first
+func LogFiles(pre string) []string {
+	names := []string{}
+	for _, fi := range logFileInfos(pre) {
+		names = append(names, path.Join(path.Dir(pre), fi.Name()))
+	}
+	return names
+}
+
+// OpenLogFile open log file, gzipped file is decompressed
+func OpenLogFile(fname string) (io.ReadCloser, error) {
+	f, err := os.Open(fname)
+	if err != nil || !strings.HasSuffix(fname, ".gz") {
+		return f, err
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipFileReader{zr, f}, nil
+}
+
+type gzipFileReader struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (self *gzipFileReader) Close() error {
+	self.Reader.Close()
+	return self.f.Close()
+}
+
+// rotated returns rotated files except active, oldest first
+func (self *FileSink) rotated(active string) []os.FileInfo {
+	files := []os.FileInfo{}
+	for _, fi := range logFileInfos(self.pre) {
+		if fi.Name() != path.Base(active) {
+			files = append(files, fi)
+		}
+	}
+	return files
+}
+
+// archive compress and prune rotated files except active
+func (self *FileSink) archive(active string, p FilePolicy) {
+	self.amutex.Lock()
+	defer self.amutex.Unlock()
+
+	dir := path.Dir(self.pre)
+	if p.Compress {
+		for _, fi := range self.rotated(active) {
+			if !strings.HasSuffix(fi.Name(), ".gz") {
+				gzipFile(path.Join(dir, fi.Name()), fi.ModTime())
+			}
+		}
+	}
+
+	files := self.rotated(active)
+	for i, fi := range files {
+		old := p.MaxAge > 0 && time.Since(fi.ModTime()) > p.MaxAge
+		more := p.MaxCount > 0 && len(files)-i > p.MaxCount
+		if old || more {
+			os.Remove(path.Join(dir, fi.Name()))
+		}
+	}
+}
+
+// gzipFile compress fname into fname.gz and remove fname
+func gzipFile(fname string, mtime time.Time) error {
+	src, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := fname + ".gz.tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	os.Chtimes(tmp, mtime, mtime)
+	if err := os.Rename(tmp, fname+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(fname)
+}
+
+func (self *FileSink) openAndLog() error {
+	self.fmutex.Lock()
+	defer self.fmutex.Unlock()
+
+	self.mutex.Lock()
+	buf := self.buf
+	self.buf = []byte{}
+	self.cond.Broadcast()
+	self.mutex.Unlock()
+
+	if len(buf) == 0 {
+		return nil
+	}
+
+	err := self.open()
+	if err != nil {
+		self.mutex.Lock()
+		self.buf = append(buf, self.buf...)
+		self.mutex.Unlock()
+		return err
+	}
+
+	n, err := self.fio.Write(buf)
+	self.num += int64(n)
+	if err != nil {
+		self.drop(buf[n:])
+		self.close() // reopen on next write
+	}
+	return err
+}
+
+// dropBuf count pending buf kept by failed open as dropped
+func (self *FileSink) dropBuf() {
+	self.mutex.Lock()
+	buf := self.buf
+	self.buf = []byte{}
+	self.cond.Broadcast()
+	self.mutex.Unlock()
+	self.drop(buf)
+}
+
+func (self *FileSink) flush() {
+	defer close(self.stopped)
+	ticker := time.NewTicker(dropReportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.dirty:
+			// failed lines are dropped, file is opened again on next write
+			if err := self.openAndLog(); err != nil {
+				self.dropBuf()
+			}
+		case <-ticker.C:
+			self.report()
+		case <-self.done:
+			self.report()
+			if err := self.openAndLog(); err != nil {
+				self.dropBuf()
+			}
+			return
+		}
+	}
+}
+
+func (self *FileSink) signal() {
+	select {
+	case self.dirty <- true:
+	default:
+	}
+}
+
+// SetBufLimit limit async buf to max bytes, full decides what to do when buf is full
+// max <= 0 means unlimited
+func (self *FileSink) SetBufLimit(max int, full FullPolicy) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.limit = max
+	self.full = full
+	self.cond.Broadcast()
+}
+
+// Dropped returns total dropped lines and bytes
+func (self *FileSink) Dropped() (int64, int64) {
+	return atomic.LoadInt64(&self.dropLines), atomic.LoadInt64(&self.dropBytes)
+}
+
+func (self *FileSink) drop(b []byte) {
+	atomic.AddInt64(&self.dropLines, int64(bytes.Count(b, []byte("\n"))))
+	atomic.AddInt64(&self.dropBytes, int64(len(b)))
+}
+
+// reserve make room for n bytes, returns false if lines should be dropped
+// mutex must be held
+func (self *FileSink) reserve(n int) bool {
+	for !self.sync && !self.closed && self.limit > 0 &&
+		len(self.buf) > 0 && len(self.buf)+n > self.limit {
+		switch self.full {
+		case FullDropNewest:
+			return false
+		case FullDropOldest:
+			i := bytes.IndexByte(self.buf, '\n')
+			if i < 0 {
+				i = len(self.buf) - 1
+			}
+			self.drop(self.buf[:i+1])
+			self.buf = self.buf[i+1:]
+		default:
+			self.signal()
+			self.cond.Wait()
+		}
+	}
+	return true
+}
+
+// discard drop pending buf, it is not counted as dropped
+func (self *FileSink) discard() {
+	self.mutex.Lock()
+	self.buf = []byte{}
+	self.cond.Broadcast()
+	self.mutex.Unlock()
+}
+
+// setFormat set format of drop report, loggers set it to their format
+func (self *FileSink) setFormat(f Formatter) {
+	self.format.Store(f)
+}
+
+// report write dropped lines since last report into log
+// lines are counted as reported only after report is written
+func (self *FileSink) report() {
+	lines, num := self.Dropped()
+	if lines == self.droppedLines {
+		return
+	}
+
+	pc, file, line, _ := runtime.Caller(0)
+	e := &Entry{
+		Time:  time.Now(),
+		Level: LevelError,
+		File:  path.Base(file),
+		Func:  runtime.FuncForPC(pc).Name(),
+		Line:  line,
+		Msg: fmt.Sprintf("log buf full, dropped %d lines, total %d lines %d bytes",
+			lines-self.droppedLines, lines, num),
+	}
+	format, _ := self.format.Load().(Formatter)
+	if format == nil {
+		format = TextFormatter
+	}
+
+	self.mutex.Lock()
+	self.buf = append(format(self.buf, e), '\n')
+	self.mutex.Unlock()
+	if err := self.openAndLog(); err != nil {
+		self.dropBuf()
+		return
+	}
+	self.droppedLines = lines
+}
+
+// Write append lines to buf, sync or closed sink writes file immediately
+// async sink with limited buf blocks or drops lines when buf is full
+func (self *FileSink) Write(b []byte) error {
+	self.mutex.Lock()
+	if !self.reserve(len(b)) {
+		self.mutex.Unlock()
+		self.drop(b)
+		return nil
+	}
+	self.buf = append(self.buf, b...)
+	closed := self.closed
+	self.mutex.Unlock()
+
+	if self.sync || closed {
+		err := self.openAndLog()
+		self.fmutex.Lock()
+		self.close()
+		self.fmutex.Unlock()
+		return err
+	}
+	self.signal()
+	return nil
+}
+
+// Flush write pending buf to file
+func (self *FileSink) Flush() error {
+	return self.openAndLog()
+}
+
+// Close stop flush goroutine, write pending buf and close log file
+// lines written after Close are written synchronously
+func (self *FileSink) Close() error {
+	self.mutex.Lock()
+	closed := self.closed
+	self.closed = true
+	self.cond.Broadcast()
+	self.mutex.Unlock()
+
+	if !self.sync && !closed {
+		close(self.done)
+		<-self.stopped
+	}
+
+	err := self.openAndLog()
+	self.fmutex.Lock()
+	self.close()
+	self.fmutex.Unlock()
+	return err
+}
+
+// WriterSink write lines to io.Writer, e.g. os.Stdout, os.Stderr
+type WriterSink struct {
+	w     io.Writer
+	mutex sync.Mutex // lock: w
+}
+
+// NewWriterSink create writer sink
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// Write write lines to writer
+func (self *WriterSink) Write(b []byte) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	_, err := self.w.Write(b)
+	return err
+}
+
+// Flush flush writer if it is buffered
+func (self *WriterSink) Flush() error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if f, ok := self.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close flush writer, writer is owned by caller
+func (self *WriterSink) Close() error {
+	return self.Flush()
+}
+
+// SyslogSink send lines to local syslog through unix socket
+type SyslogSink struct {
+	addr  string
+	tag   string
+	pri   int      // syslog priority, facility<<3 | severity
+	conn  net.Conn // nil means not connected
+	mutex sync.Mutex
+}
+
+// NewSyslogSink create syslog sink, empty addr means /dev/log
+// e.g. pri=1<<3|6 means facility user and severity info
+func NewSyslogSink(addr, tag string, pri int) (*SyslogSink, error) {
+	if addr == "" {
+		addr = "/dev/log"
+	}
+	s := &SyslogSink{addr: addr, tag: tag, pri: pri}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (self *SyslogSink) connect() error {
+	if self.conn != nil {
+		self.conn.Close()
+		self.conn = nil
+	}
+
+	var err error
+	for _, network := range []string{"unixgram", "unix"} {
+		self.conn, err = net.Dial(network, self.addr)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Write send each line as one syslog message, reconnect once on error
+func (self *SyslogSink) Write(b []byte) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, line := range bytes.Split(bytes.TrimRight(b, "\n"), []byte("\n")) {
+		msg := fmt.Sprintf("<%d>%s %s[%d]: %s\n", self.pri,
+			time.Now().Format(time.Stamp), self.tag, os.Getpid(), line)
+		if self.conn != nil {
+			if _, err := self.conn.Write([]byte(msg)); err == nil {
+				continue
+			}
+		}
+		if err := self.connect(); err != nil {
+			return err
+		}
+		if _, err := self.conn.Write([]byte(msg)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush do nothing, each line is sent on Write
+func (self *SyslogSink) Flush() error {
+	return nil
+}
+
+// Close close syslog connection
+func (self *SyslogSink) Close() error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.conn == nil {
+		return nil
+	}
+	err := self.conn.Close()
+	self.conn = nil
+	return err
+}
+
+// RingSink keeps recent lines in memory
+type RingSink struct {
+	lines []string
+	next  int  // next write position
+	full  bool // lines is full
+	mutex sync.Mutex
+}
+
+// NewRingSink create ring sink which keeps num recent lines
+func NewRingSink(num int) *RingSink {
+	if num < 1 {
+		num = 1
+	}
+	return &RingSink{lines: make([]string, num)}
+}
+
+// Write save lines into ring, oldest lines are overwritten
+func (self *RingSink) Write(b []byte) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, line := range bytes.Split(bytes.TrimRight(b, "\n"), []byte("\n")) {
+		self.lines[self.next] = string(line)
+		self.next++
+		if self.next == len(self.lines) {
+			self.next = 0
+			self.full = true
+		}
+	}
+	return nil
+}
+
+// Lines returns saved lines, oldest first
+func (self *RingSink) Lines() []string {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if !self.full {
+		return append([]string{}, self.lines[:self.next]...)
+	}
+	return append(append([]string{}, self.lines[self.next:]...), self.lines[:self.next]...)
+}
+
+// Flush do nothing
+func (self *RingSink) Flush() error {
+	return nil
+}
+
+// Close do nothing
+func (self *RingSink) Close() error {
+	return nil
+}
@@ -0,0 +1,51 @@
+package mgo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSinkReportFormat(t *testing.T) {
+	pre := filepath.Join(t.TempDir(), "app")
+	s := NewFileSink(true, pre, 16*SIZE_1M)
+	l := &Logger{level: int32(LevelDebug)}
+	l.AddSink(s, LevelDebug, nil)
+	l.SetFormat(JsonFormatter)
+
+	s.drop([]byte("lost\n"))
+	s.report()
+	s.Close()
+	b, _ := os.ReadFile(LogFiles(pre)[0])
+	if line := string(b); !strings.HasPrefix(line, "{") || !strings.Contains(line, "dropped 1 lines") {
+		t.Errorf("report not json: %s", line)
+	}
+}
+
+func TestFileSinkFlushFailed(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "d")
+	os.WriteFile(dir, nil, 0644) // file in place of dir, open fails
+	pre := filepath.Join(dir, "app")
+	s := NewFileSink(false, pre, 16*SIZE_1M)
+	s.Write([]byte("l1\n"))
+	for i := 0; i < 100; i++ {
+		if lines, _ := s.Dropped(); lines == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if lines, _ := s.Dropped(); lines != 1 {
+		t.Fatalf("dropped %d lines", lines)
+	}
+
+	os.Remove(dir)
+	s.Write([]byte("l2\n"))
+	s.Close()
+	b, _ := os.ReadFile(LogFiles(pre)[0])
+	out := string(b)
+	if strings.Contains(out, "l1") || !strings.Contains(out, "l2") || !strings.Contains(out, "dropped 1 lines") {
+		t.Errorf("retry after failed flush:\n%s", out)
+	}
+}
@@ -0,0 +1,185 @@
+package mgo
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// SlogHandler is slog.Handler which writes records through Logger
+// records keep mgo line format, including uuid and file:func():line
+type SlogHandler struct {
+	logger *Logger
+	fields []Field // fields from WithAttrs
+	group  string  // key prefix from WithGroup, e.g. "g1.g2."
+}
+
+// NewSlogHandler create slog handler backed by logger
+// nil logger means global logger, looked up for each record
+func NewSlogHandler(l *Logger) *SlogHandler {
+	return &SlogHandler{logger: l}
+}
+
+// InitSlog set slog default logger backed by global logger
+func InitSlog() {
+	slog.SetDefault(slog.New(NewSlogHandler(nil)))
+}
+
+func (self *SlogHandler) getLogger() *Logger {
+	if self.logger == nil {
+		return glogger()
+	}
+	return self.logger
+}
+
+func levelFromSlog(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelError:
+		return LevelInfo
+	}
+	return LevelError
+}
+
+func levelToSlog(level Level) slog.Level {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelError:
+		return slog.LevelError
+	}
+	return slog.LevelError + 4
+}
+
+// appendAttr flatten group attrs into fields with dotted keys
+func appendAttr(fields []Field, prefix string, a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() != slog.KindGroup {
+		return append(fields, Field{prefix + a.Key, a.Value.Any()})
+	}
+	if a.Key != "" {
+		prefix += a.Key + "."
+	}
+	for _, ga := range a.Value.Group() {
+		fields = appendAttr(fields, prefix, ga)
+	}
+	return fields
+}
+
+// Enabled check logger's level
+func (self *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return self.getLogger().Enabled(levelFromSlog(level))
+}
+
+// Handle convert record to entry and write it through logger
+func (self *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	e := &Entry{
+		Time:   r.Time,
+		Level:  levelFromSlog(r.Level),
+		PC:     r.PC,
+		Msg:    strings.TrimSpace(r.Message),
+		Fields: append([]Field{}, self.fields...),
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if r.PC != 0 {
+		c := callerOf(r.PC)
+		e.File = c.file
+		e.Func = c.fn
+		e.Line = c.line
+	}
+	if uuid := ctxUuid(ctx); uuid != "" {
+		e.Uuid = uuid
+		e.Cache = UuidCacheSize()
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		e.Fields = appendAttr(e.Fields, self.group, a)
+		return true
+	})
+
+	self.getLogger().write(e)
+	return nil
+}
+
+// WithAttrs returns handler with attrs attached
+func (self *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h := *self
+	h.fields = append([]Field{}, self.fields...)
+	for _, a := range attrs {
+		h.fields = appendAttr(h.fields, self.group, a)
+	}
+	return &h
+}
+
+// WithGroup returns handler with key prefix
+func (self *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return self
+	}
+	h := *self
+	h.group += name + "."
+	return &h
+}
+
+// SlogSink forward log entries to slog.Handler
+type SlogSink struct {
+	handler slog.Handler
+}
+
+// NewSlogSink create sink forwarding to handler
+func NewSlogSink(h slog.Handler) *SlogSink {
+	return &SlogSink{handler: h}
+}
+
+// ForwardSlog forward logger's lines at or above level to handler
+func (self *Logger) ForwardSlog(h slog.Handler, level Level) *SlogSink {
+	s := NewSlogSink(h)
+	self.AddSink(s, level, nil)
+	return s
+}
+
+// WriteEntry convert entry to record, uuid is attached as attr "uuid"
+func (self *SlogSink) WriteEntry(e *Entry) error {
+	ctx := context.Background()
+	level := levelToSlog(e.Level)
+	if !self.handler.Enabled(ctx, level) {
+		return nil
+	}
+
+	r := slog.NewRecord(e.Time, level, e.Msg, e.PC)
+	if e.Uuid != "" {
+		r.AddAttrs(slog.String("uuid", e.Uuid))
+	}
+	for _, f := range e.Fields {
+		r.AddAttrs(slog.Any(f.Key, f.Value))
+	}
+	return self.handler.Handle(ctx, r)
+}
+
+// Write forward raw lines as info records
+func (self *SlogSink) Write(b []byte) error {
+	ctx := context.Background()
+	if !self.handler.Enabled(ctx, slog.LevelInfo) {
+		return nil
+	}
+	r := slog.NewRecord(time.Now(), slog.LevelInfo, strings.TrimSpace(string(b)), 0)
+	return self.handler.Handle(ctx, r)
+}
+
+// Flush do nothing
+func (self *SlogSink) Flush() error {
+	return nil
+}
+
+// Close do nothing
+func (self *SlogSink) Close() error {
+	return nil
+}
@@ -0,0 +1,234 @@
+package mgo
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Span is a timed operation of a request, spans of a request share uuid
+// End logs span by logger "span" and keeps it for WriteChromeTrace
+type Span struct {
+	Id     int64
+	Parent int64 // parent span id, 0 for root span
+	Name   string
+	Uuid   string // request uuid, from ctx or goroutine's uuid
+	Gid    int64  // goroutine started span, 0 unless SetSpanGoId
+	Start  time.Time
+	Dur    time.Duration // set by End
+	Attrs  []Field
+
+	root  int64 // root span id, thread of span in chrome trace
+	ended int32
+	mutex sync.Mutex // lock: Attrs
+}
+
+type spanKey struct{}
+
+var (
+	spanId    = int64(0) // atomic last span id
+	spans     = []*Span{}
+	spanNext  = 0 // next write position of spans ring
+	spanSize  = SPAN_RING_SIZE
+	spanMutex = sync.Mutex{} // lock: spans, spanNext, spanSize
+	spanGoId  int32          // atomic, record Gid of span if not 0
+)
+
+// SetSpanGoId enable or disable recording goroutine id in spans
+// GoId costs several µs, without it spans of a request tree share one thread
+func SetSpanGoId(on bool) {
+	if on {
+		atomic.StoreInt32(&spanGoId, 1)
+	} else {
+		atomic.StoreInt32(&spanGoId, 0)
+	}
+}
+
+// StartSpan start span of name, child of span in ctx if any
+// returns ctx carrying the span and request uuid
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s := &Span{
+		Id:    atomic.AddInt64(&spanId, 1),
+		Name:  name,
+		Start: time.Now(),
+	}
+	s.root = s.Id
+	if atomic.LoadInt32(&spanGoId) != 0 {
+		s.Gid = GoId()
+	}
+	if parent := SpanFrom(ctx); parent != nil {
+		s.Parent = parent.Id
+		s.Uuid = parent.Uuid
+		s.root = parent.root
+	}
+	if s.Uuid == "" {
+		s.Uuid = ctxUuid(ctx)
+	}
+	if s.Uuid != "" && RequestIDFrom(ctx) == "" {
+		ctx = WithRequestID(ctx, s.Uuid)
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SpanFrom returns span carried by ctx, nil if not set
+func SpanFrom(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SetAttr set attribute of span, logged as field
+func (self *Span) SetAttr(key string, value interface{}) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for i := range self.Attrs {
+		if self.Attrs[i].Key == key {
+			self.Attrs[i].Value = value
+			return
+		}
+	}
+	self.Attrs = append(self.Attrs, Field{key, value})
+}
+
+// End set duration, log span and keep it, only first End takes effect
+func (self *Span) End() {
+	if !atomic.CompareAndSwapInt32(&self.ended, 0, 1) {
+		return
+	}
+	self.Dur = time.Since(self.Start)
+
+	self.mutex.Lock()
+	fields := []Field{{"span", self.Name}, {"span_id", self.Id}}
+	if self.Parent != 0 {
+		fields = append(fields, Field{"parent_id", self.Parent})
+	}
+	fields = append(fields, Field{"dur", self.Dur.String()})
+	fields = append(fields, self.Attrs...)
+	self.mutex.Unlock()
+
+	if l := GetLogger("span"); l.Enabled(LevelInfo) {
+		l.output(WithRequestID(context.Background(), self.Uuid), 2, LevelInfo, "span "+self.Name, fields)
+	}
+
+	spanMutex.Lock()
+	defer spanMutex.Unlock()
+	if len(spans) < spanSize {
+		spans = append(spans, self)
+	} else {
+		spans[spanNext] = self
+		spanNext = (spanNext + 1) % spanSize
+	}
+}
+
+// SetSpanRing set number of ended spans kept for WriteChromeTrace
+func SetSpanRing(num int) {
+	if num < 1 {
+		num = 1
+	}
+	old := Spans(time.Time{}, time.Time{})
+	if len(old) > num {
+		old = old[len(old)-num:]
+	}
+
+	spanMutex.Lock()
+	defer spanMutex.Unlock()
+	spans, spanNext, spanSize = old, 0, num
+}
+
+// Spans returns ended spans overlapping [from, to), sorted by start time
+// zero from or to means no limit
+func Spans(from, to time.Time) []*Span {
+	spanMutex.Lock()
+	ss := []*Span{}
+	for _, s := range spans {
+		if !from.IsZero() && s.Start.Add(s.Dur).Before(from) {
+			continue
+		}
+		if !to.IsZero() && !s.Start.Before(to) {
+			continue
+		}
+		ss = append(ss, s)
+	}
+	spanMutex.Unlock()
+
+	sort.SliceStable(ss, func(i, j int) bool { return ss[i].Start.Before(ss[j].Start) })
+	return ss
+}
+
+// WriteChromeTrace write ended spans overlapping [from, to) as Chrome
+// trace-event json, open it in chrome://tracing or ui.perfetto.dev
+// each request uuid is shown as a process, each goroutine as a thread, or
+// each root span if goroutine ids are off, attrs are redacted as span logger
+func WriteChromeTrace(w io.Writer, from, to time.Time) error {
+	type event struct {
+		Name string                 `json:"name"`
+		Cat  string                 `json:"cat,omitempty"`
+		Ph   string                 `json:"ph"`
+		Ts   int64                  `json:"ts"`
+		Dur  int64                  `json:"dur,omitempty"`
+		Pid  int                    `json:"pid"`
+		Tid  int64                  `json:"tid"`
+		Args map[string]interface{} `json:"args,omitempty"`
+	}
+
+	logger := GetLogger("span")
+	pids := map[string]int{}
+	events := []event{}
+	for _, s := range Spans(from, to) {
+		pid, ok := pids[s.Uuid]
+		if !ok {
+			pid = len(pids) + 1
+			pids[s.Uuid] = pid
+			name := s.Uuid
+			if name == "" {
+				name = "no uuid"
+			}
+			events = append(events, event{Name: "process_name", Ph: "M", Pid: pid,
+				Args: map[string]interface{}{"name": name}})
+		}
+
+		args := map[string]interface{}{"span_id": s.Id}
+		if s.Parent != 0 {
+			args["parent_id"] = s.Parent
+		}
+		s.mutex.Lock()
+		e := &Entry{Fields: append([]Field{}, s.Attrs...)}
+		s.mutex.Unlock()
+		logger.redactEntry(e)
+		for _, f := range e.Fields {
+			args[f.Key] = jsonValue(f.Value)
+		}
+		tid := s.Gid
+		if tid == 0 {
+			tid = s.root
+		}
+
+		events = append(events, event{
+			Name: s.Name,
+			Cat:  "span",
+			Ph:   "X",
+			Ts:   s.Start.UnixNano() / 1e3,
+			Dur:  int64(s.Dur / time.Microsecond),
+			Pid:  pid,
+			Tid:  tid,
+			Args: args,
+		})
+	}
+
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"traceEvents":     events,
+		"displayTimeUnit": "ms",
+	})
+}
+
+// jsonValue returns raw json of v, see appendJson
+func jsonValue(v interface{}) interface{} {
+	b := appendJson(nil, v)
+	return json.RawMessage(b)
+}
@@ -0,0 +1,59 @@
+package mgo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChromeTrace(t *testing.T) {
+	_, restore := CaptureGlogger()
+	defer restore()
+	Glog().RedactKeys("token")
+
+	from := time.Now()
+	ctx, root := StartSpan(context.Background(), "root")
+	_, child := StartSpan(ctx, "child")
+	child.SetAttr("token", "tk1")
+	child.SetAttr("note", "password=pw1")
+	child.End()
+	root.End()
+	if root.Gid != 0 || child.Gid != 0 {
+		t.Errorf("goroutine id recorded by default")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteChromeTrace(buf, from, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); strings.Contains(out, "tk1") || !strings.Contains(out, "password=pw1") {
+		t.Errorf("attrs not redacted by span logger rules: %s", out)
+	}
+	if child.Attrs[0].Value != "tk1" {
+		t.Errorf("span attr changed")
+	}
+
+	trace := struct {
+		TraceEvents []struct {
+			Name string
+			Tid  int64
+		}
+	}{}
+	json.Unmarshal(buf.Bytes(), &trace)
+	tids := map[string]int64{}
+	for _, e := range trace.TraceEvents {
+		tids[e.Name] = e.Tid
+	}
+	if tids["root"] != root.Id || tids["child"] != root.Id {
+		t.Errorf("tids %v, want root span id %d", tids, root.Id)
+	}
+
+	SetSpanGoId(true)
+	defer SetSpanGoId(false)
+	if _, s := StartSpan(context.Background(), "gid"); s.Gid != GoId() {
+		t.Errorf("gid %d", s.Gid)
+	}
+}
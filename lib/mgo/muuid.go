@@ -0,0 +1,196 @@
+package mgo
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UUID is RFC 9562 uuid, String is canonical "xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx"
+type UUID [16]byte
+
+var (
+	NilUuid = UUID{}
+
+	// name space ids of RFC 9562 for UuidV5
+	UuidNamespaceDNS  = MustParseUuid("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	UuidNamespaceURL  = MustParseUuid("6ba7b811-9dad-11d1-80b4-00c04fd430c8")
+	UuidNamespaceOID  = MustParseUuid("6ba7b812-9dad-11d1-80b4-00c04fd430c8")
+	UuidNamespaceX500 = MustParseUuid("6ba7b814-9dad-11d1-80b4-00c04fd430c8")
+)
+
+var (
+	v7mutex = sync.Mutex{} // lock: v7ms, v7seq
+	v7ms    = int64(0)     // unix ms of last v7 uuid
+	v7seq   = uint16(0)    // 12 bits counter in same ms
+)
+
+func randRead(b []byte) {
+	if n, err := rand.Read(b); n != len(b) || err != nil {
+		Fatalf(err)
+	}
+}
+
+func (self *UUID) setVersion(v byte) {
+	self[6] = self[6]&0x0f | v<<4
+	self[8] = self[8]&0x3f | 0x80
+}
+
+// UuidV4 returns random uuid
+func UuidV4() UUID {
+	u := UUID{}
+	randRead(u[:])
+	u.setVersion(4)
+	return u
+}
+
+// UuidV7 returns time-ordered uuid, 48 bits unix ms, 12 bits counter and
+// 62 random bits, uuids of a process are strictly increasing
+func UuidV7() UUID {
+	u := UUID{}
+	randRead(u[:])
+
+	v7mutex.Lock()
+	ms := time.Now().UnixMilli()
+	if ms > v7ms {
+		v7ms = ms
+		v7seq = binary.BigEndian.Uint16(u[6:8]) & 0x7ff // random start, half space left
+	} else {
+		v7seq++
+		if v7seq > 0xfff {
+			v7ms++
+			v7seq = 0
+		}
+	}
+	ms, seq := v7ms, v7seq
+	v7mutex.Unlock()
+
+	binary.BigEndian.PutUint16(u[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(u[2:6], uint32(ms))
+	binary.BigEndian.PutUint16(u[6:8], seq)
+	u.setVersion(7)
+	return u
+}
+
+// UuidV5 returns name-based uuid of name in name space ns, using sha1
+func UuidV5(ns UUID, name string) UUID {
+	h := sha1.New()
+	h.Write(ns[:])
+	h.Write([]byte(name))
+	u := UUID{}
+	copy(u[:], h.Sum(nil))
+	u.setVersion(5)
+	return u
+}
+
+// ParseUuid parse canonical uuid, also accept 32 hex digits, braces and
+// "urn:uuid:" prefix, hex digits are case-insensitive
+func ParseUuid(s string) (UUID, error) {
+	u := UUID{}
+	str := strings.TrimPrefix(strings.ToLower(s), "urn:uuid:")
+	if len(str) == 38 && str[0] == '{' && str[37] == '}' {
+		str = str[1:37]
+	}
+	if len(str) == 36 {
+		if str[8] != '-' || str[13] != '-' || str[18] != '-' || str[23] != '-' {
+			return u, fmt.Errorf("invalid uuid %q", s)
+		}
+		str = str[:8] + str[9:13] + str[14:18] + str[19:23] + str[24:]
+	}
+	if len(str) != 32 {
+		return u, fmt.Errorf("invalid uuid %q", s)
+	}
+	if _, err := hex.Decode(u[:], []byte(str)); err != nil {
+		return u, fmt.Errorf("invalid uuid %q", s)
+	}
+	return u, nil
+}
+
+// MustParseUuid parse uuid, fatal if s is invalid
+func MustParseUuid(s string) UUID {
+	u, err := ParseUuid(s)
+	if err != nil {
+		Fatalf(err)
+	}
+	return u
+}
+
+func (self UUID) String() string {
+	return string(self.appendText(nil))
+}
+
+func (self UUID) appendText(b []byte) []byte {
+	buf := [36]byte{}
+	hex.Encode(buf[0:8], self[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], self[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], self[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], self[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], self[10:])
+	return append(b, buf[:]...)
+}
+
+// Version returns uuid version, e.g. 4, 5, 7
+func (self UUID) Version() int {
+	return int(self[6] >> 4)
+}
+
+// IsZero check if uuid is nil uuid
+func (self UUID) IsZero() bool {
+	return self == NilUuid
+}
+
+// Time returns time of v7 uuid, zero time for other versions
+func (self UUID) Time() time.Time {
+	if self.Version() != 7 {
+		return time.Time{}
+	}
+	ms := int64(binary.BigEndian.Uint16(self[0:2]))<<32 | int64(binary.BigEndian.Uint32(self[2:6]))
+	return time.UnixMilli(ms)
+}
+
+func (self UUID) MarshalText() ([]byte, error) {
+	return self.appendText(nil), nil
+}
+
+func (self *UUID) UnmarshalText(b []byte) error {
+	u, err := ParseUuid(string(b))
+	if err != nil {
+		return err
+	}
+	*self = u
+	return nil
+}
+
+// Scan implements sql.Scanner, src is string, 16 raw bytes or text bytes
+// NULL is scanned as nil uuid
+func (self *UUID) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*self = NilUuid
+		return nil
+	case string:
+		return self.UnmarshalText([]byte(src))
+	case []byte:
+		if len(src) == 16 {
+			copy(self[:], src)
+			return nil
+		}
+		return self.UnmarshalText(src)
+	}
+	return fmt.Errorf("cannot scan %T into uuid", src)
+}
+
+// Value implements driver.Valuer, uuid is stored as canonical string
+func (self UUID) Value() (driver.Value, error) {
+	return self.String(), nil
+}